@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/phillip-england/thispage/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config [project-path]",
+	Short: "Print the effective configuration for a thispage project",
+	Long: `Config loads thispage.toml from the project (if present), applies any
+THISPAGE_* environment variable overrides (including those from the project's
+.env file), validates the result and prints it as TOML.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath := "."
+		if len(args) == 1 {
+			projectPath = args[0]
+		}
+
+		cfg, err := config.Load(projectPath)
+		if err != nil {
+			fmt.Printf("Error loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+
+		encoded, err := cfg.Encode()
+		if err != nil {
+			fmt.Printf("Error encoding configuration: %v\n", err)
+			os.Exit(1)
+		}
+
+		if _, err := os.Stat(config.Path(projectPath)); err != nil {
+			fmt.Printf("# No %s found, showing defaults and environment overrides\n", config.FileName)
+		}
+		fmt.Print(encoded)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+}
@@ -5,13 +5,16 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/phillip-england/thispage/pkg/audit"
+	"github.com/phillip-england/thispage/pkg/auth"
 	"github.com/phillip-england/thispage/pkg/credentials"
+	"github.com/phillip-england/thispage/pkg/database"
 	"github.com/spf13/cobra"
 )
 
 var credentialsCmd = &cobra.Command{
 	Use:   "credentials <project-path>",
-	Short: "Show the stored admin credentials for a thispage project",
+	Short: "Show the admin users for a thispage project",
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		projectPath, err := absPath(args[0])
@@ -20,42 +23,49 @@ var credentialsCmd = &cobra.Command{
 			return
 		}
 
-		username, password, err := credentials.Load(projectPath)
+		users, err := credentials.Users(projectPath)
 		if err != nil {
 			fmt.Printf("Error loading credentials: %v\n", err)
 			return
 		}
 
-		sessionKey, err := credentials.ProjectSeed(projectPath)
-		if err != nil {
-			fmt.Printf("Error loading session key: %v\n", err)
-			return
+		for _, user := range users {
+			fmt.Printf("User:        %s (%s)\n", user.Username, user.Role)
 		}
-
-		fmt.Printf("Username:    %s\nPassword:    %s\nSession Key: %s\n", username, password, sessionKey)
+		// Only argon2id hashes are stored, so passwords cannot be shown. The
+		// project seed decrypts the credentials file and is never printed.
+		fmt.Printf("Passwords:   (hashed; change one with 'thispage credentials set')\n")
 	},
 }
 
 var credentialsSetCmd = &cobra.Command{
 	Use:   "set <project-path> <username> <password>",
-	Short: "Update the stored admin credentials for a thispage project",
+	Short: "Change an admin user's password (signs that user out)",
 	Args:  cobra.ExactArgs(3),
 	Run: func(cmd *cobra.Command, args []string) {
-		projectPath, err := absPath(args[0])
+		projectPath, err := openProject(args[0])
 		if err != nil {
-			fmt.Printf("Error resolving project path: %v\n", err)
+			fmt.Printf("Error opening project: %v\n", err)
 			return
 		}
+		defer database.Close()
 
 		username := args[1]
 		password := args[2]
 
-		if err := credentials.Save(projectPath, username, password); err != nil {
+		id, err := credentials.SetPassword(projectPath, username, password)
+		if err != nil {
 			fmt.Printf("Error saving credentials: %v\n", err)
 			return
 		}
+		auditCLI(projectPath, audit.UserPassword, username)
 
-		fmt.Printf("Credentials updated for '%s'\n", projectPath)
+		n, err := auth.RevokeUserSessions(id)
+		if err != nil {
+			fmt.Printf("Error ending sessions: %v\n", err)
+			return
+		}
+		fmt.Printf("Password updated for '%s' in '%s', ended %d session(s)\n", username, projectPath, n)
 	},
 }
 
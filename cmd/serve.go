@@ -1,17 +1,28 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 
 	"github.com/phillip-england/thispage/pkg/compiler"
+	"github.com/phillip-england/thispage/pkg/logging"
 	"github.com/phillip-england/thispage/pkg/server"
 	"github.com/phillip-england/thispage/pkg/watcher"
 	"github.com/spf13/cobra"
 )
 
 var port string
+var devMode bool
+var tlsCert string
+var tlsKey string
+var acmeDomains []string
+var redirectPort string
+var adminAddress string
 
 var serveCmd = &cobra.Command{
 	Use:   "serve [project-path] [port]",
@@ -45,12 +56,16 @@ var serveCmd = &cobra.Command{
 			log.Printf("Using --port %s instead of positional port %s", port, portFromArgs)
 		}
 
+		// An empty port falls back to thispage.toml / THISPAGE_PORT
 		resolvedPort := port
 		if resolvedPort == "" {
 			resolvedPort = portFromArgs
 		}
-		if resolvedPort == "" {
-			resolvedPort = "8080"
+
+		// Structured logs go where thispage.toml says from here on
+		logFile, err := logging.Setup(projectPath)
+		if err != nil {
+			log.Fatalf("Error configuring logging: %v", err)
 		}
 
 		fmt.Println("Building project...")
@@ -59,23 +74,52 @@ var serveCmd = &cobra.Command{
 		}
 		fmt.Println("Project built successfully!")
 
-		go watcher.Start(projectPath)
+		// First SIGINT/SIGTERM starts a graceful shutdown, a second one
+		// falls through to the default handler and exits immediately
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-ctx.Done()
+			stop()
+		}()
 
-		err := server.Serve(projectPath, resolvedPort)
+		w, err := watcher.Start(projectPath)
 		if err != nil {
-			log.Fatalf("Error serving project: %v", err)
+			log.Fatalf("Error starting watcher: %v", err)
 		}
 
-		if err := compiler.Build(projectPath); err != nil {
-			log.Fatalf("Error building project: %v", err)
+		serveErr := server.Serve(ctx, projectPath, server.Options{
+			Port:         resolvedPort,
+			Dev:          devMode,
+			TLSCert:      tlsCert,
+			TLSKey:       tlsKey,
+			ACMEDomains:  acmeDomains,
+			RedirectPort: redirectPort,
+			AdminAddress: adminAddress,
+		})
+
+		if err := w.Close(); err != nil {
+			fmt.Printf("Error closing watcher: %v\n", err)
 		}
 
+		if serveErr != nil {
+			fmt.Printf("Error serving project: %v\n", serveErr)
+			logFile.Close()
+			os.Exit(1)
+		}
+		logFile.Close()
+		fmt.Println("Server stopped.")
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(serveCmd)
 	serveCmd.Flags().StringVarP(&port, "port", "p", "", "Port to run the server on")
+	serveCmd.Flags().BoolVar(&devMode, "dev", false, "Reload connected browsers after each rebuild")
+	serveCmd.Flags().StringVar(&tlsCert, "tls-cert", "", "PEM certificate file; serves HTTPS together with --tls-key")
+	serveCmd.Flags().StringVar(&tlsKey, "tls-key", "", "PEM private key file for --tls-cert")
+	serveCmd.Flags().StringSliceVar(&acmeDomains, "acme-domain", nil, "Obtain certificates via ACME for this domain (repeatable)")
+	serveCmd.Flags().StringVar(&redirectPort, "redirect-port", "", "Plain HTTP port that redirects to HTTPS")
+	serveCmd.Flags().StringVar(&adminAddress, "admin-address", "", "Serve /admin and /login on this host:port instead of the public port")
 }
 
 func isValidPort(value string) bool {
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/phillip-england/thispage/pkg/audit"
+	"github.com/phillip-england/thispage/pkg/auth"
+	"github.com/phillip-england/thispage/pkg/config"
+	"github.com/phillip-england/thispage/pkg/credentials"
+	"github.com/phillip-england/thispage/pkg/database"
+	"github.com/spf13/cobra"
+)
+
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "Inspect and revoke admin sessions of a thispage project",
+}
+
+var sessionsListCmd = &cobra.Command{
+	Use:   "list <project-path>",
+	Short: "List active admin sessions",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath, err := openProject(args[0])
+		if err != nil {
+			fmt.Printf("Error opening project: %v\n", err)
+			return
+		}
+		defer database.Close()
+
+		users, err := credentials.Users(projectPath)
+		if err != nil {
+			fmt.Printf("Error loading users: %v\n", err)
+			return
+		}
+		usernames := map[string]string{}
+		for _, user := range users {
+			usernames[user.ID] = user.Username
+		}
+
+		sessions, err := auth.ListSessions("")
+		if err != nil {
+			fmt.Printf("Error listing sessions: %v\n", err)
+			return
+		}
+		for _, s := range sessions {
+			fmt.Printf("%-6d %-24s %-40s last seen %s\n", s.ID, usernames[s.UserID], s.IPAddress, s.LastSeenAt.Format("2006-01-02 15:04"))
+		}
+	},
+}
+
+var sessionsRevokeAllCmd = &cobra.Command{
+	Use:   "revoke-all <project-path>",
+	Short: "Sign every admin user out of every browser",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := openProject(args[0]); err != nil {
+			fmt.Printf("Error opening project: %v\n", err)
+			return
+		}
+		defer database.Close()
+
+		n, err := auth.RevokeAllSessions()
+		if err != nil {
+			fmt.Printf("Error revoking sessions: %v\n", err)
+			return
+		}
+		audit.RecordAs(nil, audit.CLIActor, audit.SessionsRevokeAll, "")
+		fmt.Printf("Revoked %d session(s)\n", n)
+	},
+}
+
+// openProject loads the project's configuration and opens its database
+func openProject(path string) (string, error) {
+	projectPath, err := absPath(path)
+	if err != nil {
+		return "", err
+	}
+	cfg, err := config.Load(projectPath)
+	if err != nil {
+		return "", err
+	}
+	if err := cfg.Validate(); err != nil {
+		return "", err
+	}
+	config.Set(cfg)
+	if _, err := credentials.Users(projectPath); err != nil {
+		return "", err
+	}
+	return projectPath, database.Init(projectPath, cfg.Database.BanMinutes)
+}
+
+func init() {
+	sessionsCmd.AddCommand(sessionsListCmd, sessionsRevokeAllCmd)
+	rootCmd.AddCommand(sessionsCmd)
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/phillip-england/thispage/pkg/sites"
+	"github.com/spf13/cobra"
+)
+
+var sitesPort string
+var sitesTrustedProxies []string
+
+var sitesCmd = &cobra.Command{
+	Use:   "sites <sites-file>",
+	Short: "Serve several projects from one port, routed by Host header",
+	Long: `Serve several thispage projects from one port. Each project runs as its own
+server (with its own database, credentials and Tailwind watcher) and requests
+are routed to it by Host header. The sites file lists the projects:
+
+  [[site]]
+  hosts = ["example.com", "www.example.com"]
+  path = "/srv/example"
+
+Edits to the sites file (or SIGHUP) add, remove and re-route sites without a restart.
+
+Behind a load balancer or CDN, list it with --trusted-proxies so the sites see
+the real client IP instead of the proxy's. Each site trusts the supervisor and
+these proxies in place of its own server.trusted_proxies. Sites speak plain HTTP
+to the supervisor, so projects that enable [tls] are rejected; terminate TLS
+in front of the supervisor instead.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		sitesFile := args[0]
+
+		if !isValidPort(sitesPort) {
+			fmt.Printf("Invalid port: %s\n", sitesPort)
+			os.Exit(1)
+		}
+
+		list, err := sites.Load(sitesFile)
+		if err != nil {
+			fmt.Printf("Error loading sites: %v\n", err)
+			os.Exit(1)
+		}
+
+		supervisor, err := sites.NewSupervisor(sitesTrustedProxies)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := supervisor.Apply(list); err != nil {
+			fmt.Printf("Error starting sites: %v\n", err)
+		}
+
+		watcher, err := supervisor.Watch(sitesFile)
+		if err != nil {
+			fmt.Printf("Error watching %s: %v\n", sitesFile, err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		hangup := make(chan os.Signal, 1)
+		signal.Notify(hangup, syscall.SIGHUP)
+		go func() {
+			for range hangup {
+				supervisor.Reload(sitesFile)
+			}
+		}()
+
+		srv := &http.Server{
+			Addr:    ":" + sitesPort,
+			Handler: supervisor,
+		}
+		serveErr := make(chan error, 1)
+		go func() {
+			slog.Info("serving sites 🚀", "port", sitesPort, "count", len(list))
+			serveErr <- srv.ListenAndServe()
+		}()
+
+		exitCode := 0
+		select {
+		case err := <-serveErr:
+			if !errors.Is(err, http.ErrServerClosed) {
+				fmt.Printf("Error serving sites: %v\n", err)
+				exitCode = 1
+			}
+		case <-ctx.Done():
+			stop()
+			slog.Info("shutting down sites")
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			srv.Shutdown(shutdownCtx)
+			cancel()
+		}
+
+		signal.Stop(hangup)
+		if watcher != nil {
+			watcher.Close()
+		}
+		supervisor.Close()
+		os.Exit(exitCode)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sitesCmd)
+	sitesCmd.Flags().StringVarP(&sitesPort, "port", "p", "8080", "Port to serve all sites on")
+	sitesCmd.Flags().StringSliceVar(&sitesTrustedProxies, "trusted-proxies", nil, "CIDRs or IPs of reverse proxies in front of the sites")
+}
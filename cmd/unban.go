@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/phillip-england/thispage/pkg/audit"
+	"github.com/phillip-england/thispage/pkg/database"
+	"github.com/phillip-england/thispage/pkg/ratelimit"
+	"github.com/spf13/cobra"
+)
+
+var unbanCmd = &cobra.Command{
+	Use:   "unban <project-path> <ip>",
+	Short: "Lift a login ban on an IP address and forget its earlier bans",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		addr, err := netip.ParseAddr(args[1])
+		if err != nil {
+			fmt.Printf("Error: %q is not an IP address\n", args[1])
+			return
+		}
+		ip := addr.Unmap().String()
+
+		if _, err := openProject(args[0]); err != nil {
+			fmt.Printf("Error opening project: %v\n", err)
+			return
+		}
+		defer database.Close()
+
+		removed, err := ratelimit.Unban(ip)
+		if err != nil {
+			fmt.Printf("Error unbanning IP: %v\n", err)
+			return
+		}
+		if !removed {
+			fmt.Printf("%s is not banned\n", ip)
+			return
+		}
+		audit.RecordAs(nil, audit.CLIActor, audit.IPUnban, ip)
+		fmt.Printf("Unbanned %s\n", ip)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(unbanCmd)
+}
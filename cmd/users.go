@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/phillip-england/thispage/pkg/apitokens"
+	"github.com/phillip-england/thispage/pkg/audit"
+	"github.com/phillip-england/thispage/pkg/auth"
+	"github.com/phillip-england/thispage/pkg/credentials"
+	"github.com/phillip-england/thispage/pkg/database"
+	"github.com/phillip-england/thispage/pkg/roles"
+	"github.com/spf13/cobra"
+)
+
+var userRole string
+
+var usersCmd = &cobra.Command{
+	Use:   "users",
+	Short: "Manage the admin users of a thispage project",
+	Long: `Manage the admin users of a thispage project. Roles:
+
+  owner   everything, including deploying and exporting the project
+  editor  templates and components only
+  viewer  read contact messages and analytics only`,
+}
+
+var usersListCmd = &cobra.Command{
+	Use:   "list <project-path>",
+	Short: "List admin users and their roles",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath, err := absPath(args[0])
+		if err != nil {
+			fmt.Printf("Error resolving project path: %v\n", err)
+			return
+		}
+
+		users, err := credentials.Users(projectPath)
+		if err != nil {
+			fmt.Printf("Error loading users: %v\n", err)
+			return
+		}
+		for _, user := range users {
+			twoFactor := ""
+			if user.TwoFactorEnabled() {
+				twoFactor = "2fa"
+			}
+			fmt.Printf("%-24s %-8s %s\n", user.Username, user.Role, twoFactor)
+		}
+	},
+}
+
+var usersAddCmd = &cobra.Command{
+	Use:   "add <project-path> <username> <password>",
+	Short: "Add an admin user",
+	Args:  cobra.ExactArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath, err := absPath(args[0])
+		if err != nil {
+			fmt.Printf("Error resolving project path: %v\n", err)
+			return
+		}
+
+		if err := credentials.AddUser(projectPath, args[1], args[2], userRole); err != nil {
+			fmt.Printf("Error adding user: %v\n", err)
+			return
+		}
+		auditCLI(projectPath, audit.UserAdd, args[1]+" ("+userRole+")")
+		fmt.Printf("Added '%s' as %s\n", args[1], userRole)
+	},
+}
+
+var usersRemoveCmd = &cobra.Command{
+	Use:   "remove <project-path> <username>",
+	Short: "Remove an admin user, end their sessions and revoke their API tokens",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath, err := openProject(args[0])
+		if err != nil {
+			fmt.Printf("Error opening project: %v\n", err)
+			return
+		}
+		defer database.Close()
+
+		id, err := credentials.RemoveUser(projectPath, args[1])
+		if err != nil {
+			fmt.Printf("Error removing user: %v\n", err)
+			return
+		}
+		auditCLI(projectPath, audit.UserRemove, args[1])
+
+		sessions, err := auth.RevokeUserSessions(id)
+		if err != nil {
+			fmt.Printf("Error ending sessions: %v\n", err)
+			return
+		}
+		tokens, err := apitokens.RevokeUser(id)
+		if err != nil {
+			fmt.Printf("Error revoking API tokens: %v\n", err)
+			return
+		}
+		fmt.Printf("Removed '%s', ended %d session(s) and revoked %d API token(s)\n", args[1], sessions, tokens)
+	},
+}
+
+var usersRoleCmd = &cobra.Command{
+	Use:   "role <project-path> <username> <role>",
+	Short: "Change an admin user's role and end their sessions",
+	Args:  cobra.ExactArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath, err := openProject(args[0])
+		if err != nil {
+			fmt.Printf("Error opening project: %v\n", err)
+			return
+		}
+		defer database.Close()
+
+		id, err := credentials.SetRole(projectPath, args[1], args[2])
+		if err != nil {
+			fmt.Printf("Error changing role: %v\n", err)
+			return
+		}
+		auditCLI(projectPath, audit.UserRole, args[1]+" ("+args[2]+")")
+
+		n, err := auth.RevokeUserSessions(id)
+		if err != nil {
+			fmt.Printf("Error ending sessions: %v\n", err)
+			return
+		}
+		fmt.Printf("'%s' is now %s, ended %d session(s)\n", args[1], args[2], n)
+	},
+}
+
+var usersReset2FACmd = &cobra.Command{
+	Use:   "reset-2fa <project-path> <username>",
+	Short: "Turn off two-factor login for a user who lost their device and recovery codes",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath, err := openProject(args[0])
+		if err != nil {
+			fmt.Printf("Error opening project: %v\n", err)
+			return
+		}
+		defer database.Close()
+
+		id, err := credentials.DisableTOTP(projectPath, args[1])
+		if err != nil {
+			fmt.Printf("Error resetting two-factor login: %v\n", err)
+			return
+		}
+		auditCLI(projectPath, audit.TOTPReset, args[1])
+
+		n, err := auth.RevokeUserSessions(id)
+		if err != nil {
+			fmt.Printf("Error ending sessions: %v\n", err)
+			return
+		}
+		fmt.Printf("Two-factor login turned off for '%s', ended %d session(s)\n", args[1], n)
+	},
+}
+
+// auditCLI writes a change made with the thispage command to the project's
+// audit log. The change has already happened, so a failure only warns.
+func auditCLI(projectPath, action, target string) {
+	if database.DB == nil {
+		if _, err := openProject(projectPath); err != nil {
+			fmt.Printf("Warning: could not write audit log: %v\n", err)
+			return
+		}
+		defer database.Close()
+	}
+	audit.RecordAs(nil, audit.CLIActor, action, target)
+}
+
+func init() {
+	usersAddCmd.Flags().StringVar(&userRole, "role", roles.Viewer, "Role of the new user: "+strings.Join(roles.All, ", "))
+	usersCmd.AddCommand(usersListCmd, usersAddCmd, usersRemoveCmd, usersRoleCmd, usersReset2FACmd)
+	rootCmd.AddCommand(usersCmd)
+}
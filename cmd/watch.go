@@ -1,6 +1,12 @@
 package cmd
 
 import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/phillip-england/thispage/pkg/logging"
 	"github.com/phillip-england/thispage/pkg/watcher"
 	"github.com/spf13/cobra"
 )
@@ -11,8 +17,27 @@ var watchCmd = &cobra.Command{
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		projectPath := args[0]
-		watcher.Start(projectPath)
-		select {}
+		logFile, err := logging.Setup(projectPath)
+		if err != nil {
+			fmt.Printf("Error configuring logging: %v\n", err)
+			os.Exit(1)
+		}
+		defer logFile.Close()
+
+		w, err := watcher.Start(projectPath)
+		if err != nil {
+			fmt.Printf("Error starting watcher: %v\n", err)
+			os.Exit(1)
+		}
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+
+		if err := w.Close(); err != nil {
+			fmt.Printf("Error closing watcher: %v\n", err)
+			os.Exit(1)
+		}
 	},
 }
 
@@ -3,11 +3,15 @@ module github.com/phillip-england/thispage
 go 1.25.5
 
 require (
+	github.com/BurntSushi/toml v1.5.0
+	github.com/andybalholm/brotli v1.2.6
 	github.com/fsnotify/fsnotify v1.9.0
 	github.com/joho/godotenv v1.5.1
 	github.com/phillip-england/vii v0.0.17
 	github.com/spf13/cobra v1.10.2
+	golang.org/x/crypto v0.46.0
 	modernc.org/sqlite v1.42.2
+	rsc.io/qr v0.2.0
 )
 
 require (
@@ -19,7 +23,9 @@ require (
 	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
 	github.com/spf13/pflag v1.0.10 // indirect
 	golang.org/x/exp v0.0.0-20250620022241-b7579e27df2b // indirect
+	golang.org/x/net v0.47.0 // indirect
 	golang.org/x/sys v0.39.0 // indirect
+	golang.org/x/text v0.32.0 // indirect
 	modernc.org/libc v1.66.10 // indirect
 	modernc.org/mathutil v1.7.1 // indirect
 	modernc.org/memory v1.11.0 // indirect
@@ -0,0 +1,235 @@
+package analytics
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phillip-england/thispage/pkg/config"
+	"github.com/phillip-england/thispage/pkg/database"
+)
+
+// dayFormat is how PAGE_VIEW.day is stored; it sorts chronologically as text
+const dayFormat = "2006-01-02"
+
+// maxPathLength keeps oversized URLs from bloating the table
+const maxPathLength = 512
+
+// Agent classes recorded instead of the raw User-Agent
+const (
+	AgentBot     = "bot"
+	AgentMobile  = "mobile"
+	AgentTablet  = "tablet"
+	AgentDesktop = "desktop"
+	AgentOther   = "other"
+)
+
+var (
+	pruneMu    sync.Mutex
+	lastPruned string
+)
+
+// Record counts a view of the page at r.URL.Path. Only the day, path,
+// referring host and a coarse agent class are kept; visitors who send
+// Do Not Track or Global Privacy Control are not counted at all.
+func Record(r *http.Request) error {
+	cfg := config.Get().Analytics
+	if !cfg.Enabled {
+		return nil
+	}
+	if r.Header.Get("DNT") == "1" || r.Header.Get("Sec-GPC") == "1" {
+		return nil
+	}
+
+	path := r.URL.Path
+	if len(path) > maxPathLength {
+		path = path[:maxPathLength]
+	}
+	day := time.Now().UTC().Format(dayFormat)
+
+	_, err := database.DB.Exec(`
+		INSERT INTO PAGE_VIEW (day, path, referrer_host, agent_class, views)
+		VALUES (?, ?, ?, ?, 1)
+		ON CONFLICT(day, path, referrer_host, agent_class) DO UPDATE SET views = views + 1
+	`, day, path, ReferrerHost(r), ClassifyAgent(r.UserAgent()))
+	if err != nil {
+		return err
+	}
+
+	return prune(day, cfg.RetentionDays)
+}
+
+// prune drops rows older than the retention window, at most once per day
+func prune(today string, retentionDays int) error {
+	pruneMu.Lock()
+	defer pruneMu.Unlock()
+	if lastPruned == today {
+		return nil
+	}
+	cutoff := time.Now().UTC().AddDate(0, 0, -retentionDays).Format(dayFormat)
+	if _, err := database.DB.Exec("DELETE FROM PAGE_VIEW WHERE day < ?", cutoff); err != nil {
+		return err
+	}
+	lastPruned = today
+	return nil
+}
+
+// ReferrerHost returns the host of an external Referer, or "" for direct
+// visits and navigation within the site
+func ReferrerHost(r *http.Request) string {
+	ref, err := url.Parse(r.Referer())
+	if err != nil || ref.Host == "" {
+		return ""
+	}
+	host := strings.ToLower(ref.Hostname())
+	if host == strings.ToLower(hostOnly(r.Host)) {
+		return ""
+	}
+	return strings.TrimPrefix(host, "www.")
+}
+
+func hostOnly(hostport string) string {
+	u := url.URL{Host: hostport}
+	return u.Hostname()
+}
+
+// ClassifyAgent reduces a User-Agent to bot, mobile, tablet, desktop or other
+func ClassifyAgent(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case ua == "":
+		return AgentOther
+	case strings.Contains(ua, "bot"), strings.Contains(ua, "crawl"), strings.Contains(ua, "spider"),
+		strings.Contains(ua, "curl"), strings.Contains(ua, "wget"), strings.Contains(ua, "python"),
+		strings.Contains(ua, "headless"):
+		return AgentBot
+	case strings.Contains(ua, "ipad"), strings.Contains(ua, "tablet"),
+		strings.Contains(ua, "android") && !strings.Contains(ua, "mobile"):
+		return AgentTablet
+	case strings.Contains(ua, "mobi"), strings.Contains(ua, "iphone"):
+		return AgentMobile
+	case strings.Contains(ua, "windows"), strings.Contains(ua, "macintosh"), strings.Contains(ua, "linux"),
+		strings.Contains(ua, "x11"), strings.Contains(ua, "cros"):
+		return AgentDesktop
+	}
+	return AgentOther
+}
+
+// Count is a label with its number of views
+type Count struct {
+	Label string
+	Views int
+}
+
+// Day is the view total for one day; Percent scales it against the busiest day
+type Day struct {
+	Day     string
+	Views   int
+	Percent int
+}
+
+// Summary is what the admin analytics page shows for a period
+type Summary struct {
+	Days         int
+	TotalViews   int
+	TopPages     []Count
+	TopReferrers []Count
+	Agents       []Count
+	Daily        []Day
+}
+
+// Summarize aggregates the last `days` days, including today. Bots are
+// listed under Agents but left out of every other figure.
+func Summarize(days, limit int) (Summary, error) {
+	summary := Summary{Days: days}
+	now := time.Now().UTC()
+	since := now.AddDate(0, 0, -(days - 1)).Format(dayFormat)
+
+	var err error
+	summary.TopPages, err = topCounts("path", since, limit, false)
+	if err != nil {
+		return summary, err
+	}
+	summary.TopReferrers, err = topCounts("referrer_host", since, limit, false)
+	if err != nil {
+		return summary, err
+	}
+	summary.Agents, err = topCounts("agent_class", since, limit, true)
+	if err != nil {
+		return summary, err
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT day, SUM(views) FROM PAGE_VIEW
+		WHERE day >= ? AND agent_class != ?
+		GROUP BY day
+	`, since, AgentBot)
+	if err != nil {
+		return summary, err
+	}
+	defer rows.Close()
+	perDay := map[string]int{}
+	for rows.Next() {
+		var day string
+		var views int
+		if err := rows.Scan(&day, &views); err != nil {
+			return summary, err
+		}
+		perDay[day] = views
+	}
+	if err := rows.Err(); err != nil {
+		return summary, err
+	}
+
+	// Fill in days without traffic so the chart has no gaps
+	peak := 0
+	for i := days - 1; i >= 0; i-- {
+		day := now.AddDate(0, 0, -i).Format(dayFormat)
+		views := perDay[day]
+		summary.TotalViews += views
+		if views > peak {
+			peak = views
+		}
+		summary.Daily = append(summary.Daily, Day{Day: day, Views: views})
+	}
+	for i := range summary.Daily {
+		if peak > 0 {
+			summary.Daily[i].Percent = summary.Daily[i].Views * 100 / peak
+		}
+	}
+
+	return summary, nil
+}
+
+// topCounts sums views per value of column (a fixed, trusted column name)
+func topCounts(column, since string, limit int, includeBots bool) ([]Count, error) {
+	query := "SELECT " + column + ", SUM(views) AS total FROM PAGE_VIEW WHERE day >= ?"
+	args := []interface{}{since}
+	if !includeBots {
+		query += " AND agent_class != ?"
+		args = append(args, AgentBot)
+	}
+	if column == "referrer_host" {
+		query += " AND referrer_host != ''"
+	}
+	query += " GROUP BY " + column + " ORDER BY total DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []Count
+	for rows.Next() {
+		var count Count
+		if err := rows.Scan(&count.Label, &count.Views); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
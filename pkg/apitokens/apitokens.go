@@ -0,0 +1,191 @@
+package apitokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/phillip-england/thispage/pkg/credentials"
+	"github.com/phillip-england/thispage/pkg/database"
+	"github.com/phillip-england/thispage/pkg/keys"
+	"github.com/phillip-england/thispage/pkg/roles"
+	"github.com/phillip-england/vii/vii"
+)
+
+// Scopes a token can be granted. A token never does more than its user's
+// role allows, whatever its scopes say.
+const (
+	// FilesRead lists and reads project files
+	FilesRead = "files:read"
+	// FilesWrite writes, renames and deletes project files
+	FilesWrite = "files:write"
+	// Build rebuilds the site
+	Build = "build"
+	// MessagesRead lists contact form messages
+	MessagesRead = "messages:read"
+	// Export downloads the project as a zip
+	Export = "export"
+)
+
+// Scopes lists every scope in the order the admin shows them
+var Scopes = []string{FilesRead, FilesWrite, Build, MessagesRead, Export}
+
+var scopePermissions = map[string]roles.Permission{
+	FilesRead:    roles.EditContent,
+	FilesWrite:   roles.EditContent,
+	Build:        roles.EditContent,
+	MessagesRead: roles.ReadMessages,
+	Export:       roles.ManageProject,
+}
+
+// prefix marks thispage tokens so they are easy to spot in leaked logs
+const prefix = "tp_"
+
+// Token is a stored API token. Only a hash of the secret is kept.
+type Token struct {
+	ID         int64
+	UserID     string
+	Name       string
+	Hint       string
+	Scopes     []string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
+
+// Has reports whether the token was granted scope
+func (t *Token) Has(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed reports whether role may use scope at all
+func Allowed(role, scope string) bool {
+	permission, ok := scopePermissions[scope]
+	return ok && roles.Can(role, permission)
+}
+
+// AllowedScopes filters Scopes down to the ones role may grant
+func AllowedScopes(role string) []string {
+	var allowed []string
+	for _, scope := range Scopes {
+		if Allowed(role, scope) {
+			allowed = append(allowed, scope)
+		}
+	}
+	return allowed
+}
+
+// Create stores a new token for user and returns its secret, which cannot
+// be recovered later
+func Create(user *credentials.User, name string, scopes []string) (string, error) {
+	if len(scopes) == 0 {
+		return "", fmt.Errorf("choose at least one scope")
+	}
+	for _, scope := range scopes {
+		if !Allowed(user.Role, scope) {
+			return "", fmt.Errorf("a %s cannot grant %q", user.Role, scope)
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	token := prefix + hex.EncodeToString(secret)
+
+	_, err := database.DB.Exec(`
+		INSERT INTO API_TOKEN (user_id, name, token_hash, hint, scopes, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, user.ID, name, hash(token), token[len(token)-4:], strings.Join(scopes, ","), time.Now())
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// List returns the tokens of userID, or of every user when userID is empty
+func List(userID string) ([]Token, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, user_id, name, hint, scopes, created_at, last_used_at
+		FROM API_TOKEN
+		WHERE ? = '' OR user_id = ?
+		ORDER BY created_at DESC
+	`, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []Token
+	for rows.Next() {
+		var t Token
+		var scopes string
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Name, &t.Hint, &scopes, &t.CreatedAt, &t.LastUsedAt); err != nil {
+			return nil, err
+		}
+		t.Scopes = strings.Split(scopes, ",")
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// Revoke deletes a token. A non-empty userID limits it to that user's
+// tokens. It reports whether a token was deleted.
+func Revoke(id int64, userID string) (bool, error) {
+	result, err := database.DB.Exec("DELETE FROM API_TOKEN WHERE id = ? AND (? = '' OR user_id = ?)", id, userID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// RevokeUser deletes every token of userID
+func RevokeUser(userID string) (int64, error) {
+	result, err := database.DB.Exec("DELETE FROM API_TOKEN WHERE user_id = ?", userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Authenticate returns the token in r's "Authorization: Bearer" header and
+// its user, or nil when either is missing. Tokens of removed users stop
+// working with them.
+func Authenticate(r *http.Request) (*Token, *credentials.User) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || !strings.HasPrefix(token, prefix) {
+		return nil, nil
+	}
+
+	var t Token
+	var scopes string
+	row := database.DB.QueryRow("SELECT id, user_id, name, hint, scopes, created_at FROM API_TOKEN WHERE token_hash = ?", hash(token))
+	if err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Hint, &scopes, &t.CreatedAt); err != nil {
+		return nil, nil
+	}
+	t.Scopes = strings.Split(scopes, ",")
+
+	projectPath, _ := vii.GetContext(keys.ProjectPath, r).(string)
+	user, err := credentials.UserByID(projectPath, t.UserID)
+	if err != nil || user == nil {
+		return nil, nil
+	}
+
+	database.DB.Exec("UPDATE API_TOKEN SET last_used_at = ? WHERE id = ?", time.Now(), t.ID)
+	return &t, user
+}
+
+// hash is a plain SHA-256; the secrets are random, so nothing slower is needed
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
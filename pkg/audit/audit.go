@@ -0,0 +1,169 @@
+package audit
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/phillip-england/thispage/pkg/auth"
+	"github.com/phillip-england/thispage/pkg/database"
+	"github.com/phillip-england/thispage/pkg/ratelimit"
+)
+
+// Actions written to the audit log
+const (
+	FileSave          = "file.save"
+	FileCreate        = "file.create"
+	FileRename        = "file.rename"
+	FileDelete        = "file.delete"
+	FileUpload        = "file.upload"
+	DirCreate         = "dir.create"
+	ProjectDeploy     = "project.deploy"
+	SiteBuild         = "site.build"
+	MessageDelete     = "message.delete"
+	Login             = "login"
+	Logout            = "logout"
+	TOTPEnable        = "2fa.enable"
+	TOTPDisable       = "2fa.disable"
+	TOTPReset         = "2fa.reset"
+	SessionRevoke     = "session.revoke"
+	SessionsRevokeAll = "sessions.revoke_all"
+	TokenCreate       = "token.create"
+	TokenRevoke       = "token.revoke"
+	UserAdd           = "user.add"
+	UserRemove        = "user.remove"
+	UserRole          = "user.role"
+	UserPassword      = "user.password"
+	IPUnban           = "ip.unban"
+)
+
+// CLIActor is the actor recorded for changes made with the thispage command
+const CLIActor = "cli"
+
+// Entry is one row of the audit log
+type Entry struct {
+	ID        int64     `json:"id"`
+	Actor     string    `json:"actor"`
+	IPAddress string    `json:"ip_address"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Filter narrows List down. Zero fields match everything.
+type Filter struct {
+	Actor  string
+	Action string
+	// Target matches any entry whose target contains it
+	Target string
+	Since  time.Time
+	Until  time.Time
+	// Limit caps the number of entries, newest first
+	Limit int
+}
+
+// Record logs action on target by the user signed in on r
+func Record(r *http.Request, action, target string) {
+	actor := ""
+	if user := auth.CurrentUser(r); user != nil {
+		actor = user.Username
+	}
+	RecordAs(r, actor, action, target)
+}
+
+// RecordAs logs action on target by actor, for requests that are not signed
+// in yet or anymore. r is nil for changes made outside the server.
+func RecordAs(r *http.Request, actor, action, target string) {
+	ip := ""
+	if r != nil {
+		ip = ratelimit.GetClientIP(r)
+	}
+	_, err := database.DB.Exec(`
+		INSERT INTO AUDIT_LOG (actor, ip_address, action, target, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, actor, ip, action, target, time.Now().UTC())
+	if err != nil {
+		// A broken audit log should not undo the change it failed to record
+		slog.Error("failed to write audit log", "action", action, "target", target, "error", err)
+	}
+}
+
+// List returns the entries matching f, newest first
+func List(f Filter) ([]Entry, error) {
+	query := "SELECT id, actor, ip_address, action, target, created_at FROM AUDIT_LOG"
+	var where []string
+	var args []interface{}
+	if f.Actor != "" {
+		where = append(where, "actor = ?")
+		args = append(args, f.Actor)
+	}
+	if f.Action != "" {
+		where = append(where, "action = ?")
+		args = append(args, f.Action)
+	}
+	if f.Target != "" {
+		where = append(where, "instr(target, ?) > 0")
+		args = append(args, f.Target)
+	}
+	if !f.Since.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, f.Since.UTC())
+	}
+	if !f.Until.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, f.Until.UTC())
+	}
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if f.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, f.Limit)
+	}
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.ID, &e.Actor, &e.IPAddress, &e.Action, &e.Target, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Actors returns every actor in the log, for the filter form
+func Actors() ([]string, error) {
+	return distinct("actor")
+}
+
+// Actions returns every action in the log, for the filter form
+func Actions() ([]string, error) {
+	return distinct("action")
+}
+
+func distinct(column string) ([]string, error) {
+	rows, err := database.DB.Query("SELECT DISTINCT " + column + " FROM AUDIT_LOG ORDER BY " + column)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
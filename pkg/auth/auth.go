@@ -1,15 +1,22 @@
 package auth
 
 import (
+	"context"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/phillip-england/thispage/pkg/config"
 	"github.com/phillip-england/thispage/pkg/credentials"
 	"github.com/phillip-england/thispage/pkg/database"
 	"github.com/phillip-england/thispage/pkg/keys"
+	"github.com/phillip-england/thispage/pkg/ratelimit"
 	"github.com/phillip-england/vii/vii"
 )
 
@@ -21,143 +28,310 @@ func GenerateKey() (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
+// Cleanup deletes sessions past their sliding or absolute lifetime
 func Cleanup() error {
-	_, err := database.DB.Exec("DELETE FROM session WHERE expires_at < ?", time.Now())
+	now := time.Now()
+	_, err := database.DB.Exec("DELETE FROM session WHERE expires_at < ? OR created_at < ?", now, now.Add(-absoluteLifetime()))
 	return err
 }
 
-func CreateSession(w http.ResponseWriter, r *http.Request) error {
+// CreateSession signs user in on this browser. Any session the browser
+// already had is ended, so a key planted before login is never upgraded.
+func CreateSession(w http.ResponseWriter, r *http.Request, user *credentials.User) error {
 	// Cleanup old sessions first
 	if err := Cleanup(); err != nil {
 		// Log error but continue?
 	}
 
-	key, err := GenerateKey()
+	if keyHash, _, ok := cookieKeyHash(r); ok {
+		database.DB.Exec("DELETE FROM session WHERE key_hash = ?", keyHash)
+	}
+
+	value, keyHash, err := newSessionKey(r, user)
 	if err != nil {
 		return err
 	}
 
-	token, err := sessionTokenFromRequest(r)
+	csrfToken, err := GenerateKey()
 	if err != nil {
 		return err
 	}
-	expiresAt := time.Now().Add(15 * time.Minute)
 
-	_, err = database.DB.Exec("INSERT INTO session (key, token, expires_at) VALUES (?, ?, ?)", key, token, expiresAt)
+	now := time.Now()
+	expiresAt := sessionExpiry(now, now)
+
+	_, err = database.DB.Exec(`
+		INSERT INTO session (key_hash, user_id, role, csrf_token, ip_address, user_agent, created_at, last_seen_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, keyHash, user.ID, user.Role, csrfToken, ratelimit.GetClientIP(r), userAgent(r), now, now, expiresAt)
 	if err != nil {
 		return err
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_key",
-		Value:    key,
-		Path:     "/",
-		HttpOnly: true,
-		Expires:  expiresAt,
-	})
-
+	setSessionCookie(w, r, value, expiresAt)
 	return nil
 }
 
 func IsAuthenticated(r *http.Request) bool {
-	cookie, err := r.Cookie("session_key")
-	if err != nil {
-		return false
+	return Authenticate(r) != nil
+}
+
+// Authenticate returns the user signed in with r's session cookie, or nil
+func Authenticate(r *http.Request) *credentials.User {
+	user, _ := authenticate(r)
+	return user
+}
+
+// AuthenticateAndRefresh is Authenticate that also extends the session. It
+// returns r with the user and session attached for CurrentUser, CSRFToken
+// and CurrentSessionID.
+func AuthenticateAndRefresh(w http.ResponseWriter, r *http.Request) (*credentials.User, *http.Request) {
+	user, s := authenticate(r)
+	if user == nil {
+		return nil, r
 	}
 
-	key := cookie.Value
-	tokenEnv, err := sessionTokenFromRequest(r)
+	// Extend session by another full lifetime, up to its absolute limit
+	now := time.Now()
+	newExpiry := sessionExpiry(s.createdAt, now)
+	database.DB.Exec("UPDATE session SET expires_at = ?, last_seen_at = ? WHERE id = ?", newExpiry, now, s.id)
+	setSessionCookie(w, r, s.cookie, newExpiry)
+
+	ctx := context.WithValue(r.Context(), userKey{}, user)
+	ctx = context.WithValue(ctx, sessionKey{}, &s)
+	return user, r.WithContext(ctx)
+}
+
+// RotateSession gives the session behind r a new key and CSRF token, and
+// ends every other session of its user. Call it after the user changed what
+// their sessions may do.
+func RotateSession(w http.ResponseWriter, r *http.Request) error {
+	s, _ := r.Context().Value(sessionKey{}).(*session)
+	user := CurrentUser(r)
+	if s == nil || user == nil {
+		return fmt.Errorf("no session to rotate")
+	}
+	if _, err := database.DB.Exec("DELETE FROM session WHERE user_id = ? AND id != ?", user.ID, s.id); err != nil {
+		return err
+	}
+	expiresAt, err := rotate(r, user, s)
 	if err != nil {
-		return false
+		return err
 	}
+	setSessionCookie(w, r, s.cookie, expiresAt)
+	return nil
+}
+
+// session is the row behind a valid session cookie
+type session struct {
+	id        int64
+	cookie    string
+	role      string
+	csrfToken string
+	createdAt time.Time
+}
 
-	var tokenDb string
+// authenticate looks up the session behind r's cookie and returns its user
+// and session. Sessions of removed users, and sessions that somehow outlived
+// a role change, are no longer valid.
+func authenticate(r *http.Request) (*credentials.User, session) {
+	keyHash, cookieUserID, ok := cookieKeyHash(r)
+	if !ok {
+		return nil, session{}
+	}
+
+	var s session
+	var userID string
 	var expiresAt time.Time
 
-	row := database.DB.QueryRow("SELECT token, expires_at FROM session WHERE key = ?", key)
-	err = row.Scan(&tokenDb, &expiresAt)
-	if err != nil {
-		return false
+	row := database.DB.QueryRow("SELECT id, user_id, role, csrf_token, created_at, expires_at FROM session WHERE key_hash = ?", keyHash)
+	if err := row.Scan(&s.id, &userID, &s.role, &s.csrfToken, &s.createdAt, &expiresAt); err != nil {
+		return nil, session{}
+	}
+
+	now := time.Now()
+	if now.After(expiresAt) || now.After(s.createdAt.Add(absoluteLifetime())) {
+		return nil, session{}
 	}
 
-	if time.Now().After(expiresAt) {
-		return false
+	// The key is only valid for the user it was issued to
+	if subtle.ConstantTimeCompare([]byte(userID), []byte(cookieUserID)) != 1 {
+		return nil, session{}
 	}
 
-	if tokenDb != tokenEnv {
-		return false
+	projectPath, _ := vii.GetContext(keys.ProjectPath, r).(string)
+	user, err := credentials.UserByID(projectPath, userID)
+	if err != nil || user == nil || user.Role != s.role {
+		return nil, session{}
 	}
 
-	return true
+	cookie, _ := r.Cookie("session_key")
+	s.cookie = cookie.Value
+	return user, s
 }
 
-// IsAuthenticatedAndRefresh checks authentication and extends the session
-func IsAuthenticatedAndRefresh(w http.ResponseWriter, r *http.Request) bool {
-	cookie, err := r.Cookie("session_key")
+// rotate swaps s's key and CSRF token for new ones and records the user's
+// current role. The caller sends the new cookie; rotate returns when it
+// expires.
+func rotate(r *http.Request, user *credentials.User, s *session) (time.Time, error) {
+	value, keyHash, err := newSessionKey(r, user)
 	if err != nil {
-		return false
+		return time.Time{}, err
 	}
-
-	key := cookie.Value
-	tokenEnv, err := sessionTokenFromRequest(r)
+	csrfToken, err := GenerateKey()
 	if err != nil {
-		return false
+		return time.Time{}, err
 	}
-
-	var tokenDb string
 	var expiresAt time.Time
-
-	row := database.DB.QueryRow("SELECT token, expires_at FROM session WHERE key = ?", key)
-	err = row.Scan(&tokenDb, &expiresAt)
-	if err != nil {
-		return false
+	row := database.DB.QueryRow("UPDATE session SET key_hash = ?, role = ?, csrf_token = ? WHERE id = ? RETURNING expires_at", keyHash, user.Role, csrfToken, s.id)
+	if err := row.Scan(&expiresAt); err != nil {
+		return time.Time{}, err
 	}
+	s.cookie = value
+	s.role = user.Role
+	s.csrfToken = csrfToken
+	return expiresAt, nil
+}
 
-	if time.Now().After(expiresAt) {
-		return false
-	}
+type userKey struct{}
+
+type sessionKey struct{}
+
+// CurrentUser returns the user attached by AuthenticateAndRefresh, or nil
+func CurrentUser(r *http.Request) *credentials.User {
+	user, _ := r.Context().Value(userKey{}).(*credentials.User)
+	return user
+}
+
+// WithUser attaches user to r for CurrentUser. It is for requests
+// authenticated some other way than a session, such as an API token.
+func WithUser(r *http.Request, user *credentials.User) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userKey{}, user))
+}
 
-	if tokenDb != tokenEnv {
-		return false
+func DeleteSession(w http.ResponseWriter, r *http.Request) error {
+	keyHash, _, ok := cookieKeyHash(r)
+	if !ok {
+		return nil // No session to delete
 	}
 
-	// Extend session by 15 more minutes
-	newExpiry := time.Now().Add(15 * time.Minute)
-	database.DB.Exec("UPDATE session SET expires_at = ? WHERE key = ?", newExpiry, key)
+	_, err := database.DB.Exec("DELETE FROM session WHERE key_hash = ?", keyHash)
+	if err != nil {
+		return err
+	}
 
 	http.SetCookie(w, &http.Cookie{
 		Name:     "session_key",
-		Value:    key,
+		Value:    "",
 		Path:     "/",
 		HttpOnly: true,
-		Expires:  newExpiry,
+		Secure:   secureCookies(r),
+		SameSite: sameSite(),
+		Expires:  time.Now().Add(-1 * time.Hour),
+		MaxAge:   -1,
 	})
 
-	return true
+	return nil
 }
 
-func DeleteSession(w http.ResponseWriter, r *http.Request) error {
+// newSessionKey returns a cookie value for user and the hash stored in its
+// place. The cookie names the user the key belongs to.
+func newSessionKey(r *http.Request, user *credentials.User) (value, keyHash string, err error) {
+	key, err := GenerateKey()
+	if err != nil {
+		return "", "", err
+	}
+	value = user.ID + "." + key
+	keyHash, err = hashSessionKey(r, value)
+	return value, keyHash, err
+}
+
+// cookieKeyHash hashes r's session cookie and returns the user ID it names
+func cookieKeyHash(r *http.Request) (keyHash, userID string, ok bool) {
 	cookie, err := r.Cookie("session_key")
 	if err != nil {
-		return nil // No session to delete
+		return "", "", false
+	}
+	userID, _, found := strings.Cut(cookie.Value, ".")
+	if !found {
+		return "", "", false
 	}
+	keyHash, err = hashSessionKey(r, cookie.Value)
+	if err != nil {
+		return "", "", false
+	}
+	return keyHash, userID, true
+}
 
-	key := cookie.Value
-	_, err = database.DB.Exec("DELETE FROM session WHERE key = ?", key)
+// hashSessionKey keys the hash with the project's session token, which lives
+// in the encrypted credentials file, so data.db alone is no help in forging
+// or checking a session cookie. Rotating the token ends every session.
+func hashSessionKey(r *http.Request, value string) (string, error) {
+	token, err := sessionTokenFromRequest(r)
 	if err != nil {
-		return err
+		return "", err
 	}
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
 
+func setSessionCookie(w http.ResponseWriter, r *http.Request, value string, expiresAt time.Time) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "session_key",
-		Value:    "",
+		Value:    value,
 		Path:     "/",
 		HttpOnly: true,
-		Expires:  time.Now().Add(-1 * time.Hour),
-		MaxAge:   -1,
+		Secure:   secureCookies(r),
+		SameSite: sameSite(),
+		Expires:  expiresAt,
 	})
+}
 
-	return nil
+// secureCookies keeps the session cookie off plain HTTP once it was set over
+// TLS, either here or at a trusted proxy that says so in X-Forwarded-Proto; a
+// plain admin listener on localhost or a VPN still gets a usable cookie
+func secureCookies(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	return strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") && ratelimit.FromTrustedProxy(r)
+}
+
+// sameSite keeps other sites from making the browser send the session
+// cookie along with their form posts
+func sameSite() http.SameSite {
+	if config.Get().Auth.SameSite == "strict" {
+		return http.SameSiteStrictMode
+	}
+	return http.SameSiteLaxMode
+}
+
+func sessionLifetime() time.Duration {
+	return time.Duration(config.Get().Auth.SessionMinutes) * time.Minute
+}
+
+func absoluteLifetime() time.Duration {
+	return time.Duration(config.Get().Auth.AbsoluteSessionHours) * time.Hour
+}
+
+// sessionExpiry is one sliding lifetime from now, but never past the
+// absolute lifetime of a session created at createdAt
+func sessionExpiry(createdAt, now time.Time) time.Time {
+	expiresAt := now.Add(sessionLifetime())
+	if limit := createdAt.Add(absoluteLifetime()); expiresAt.After(limit) {
+		return limit
+	}
+	return expiresAt
+}
+
+// userAgent returns r's User-Agent, cut down to what the sessions page shows
+func userAgent(r *http.Request) string {
+	ua := r.UserAgent()
+	if len(ua) > 256 {
+		ua = ua[:256]
+	}
+	return ua
 }
 
 func sessionTokenFromRequest(r *http.Request) (string, error) {
@@ -166,7 +340,7 @@ func sessionTokenFromRequest(r *http.Request) (string, error) {
 		return "", fmt.Errorf("project path not found in context")
 	}
 
-	_, _, token, err := credentials.LoadWithToken(projectPath)
+	token, err := credentials.SessionToken(projectPath)
 	if err != nil {
 		return "", err
 	}
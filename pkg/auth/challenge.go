@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/phillip-england/thispage/pkg/credentials"
+	"github.com/phillip-england/thispage/pkg/database"
+	"github.com/phillip-england/thispage/pkg/keys"
+	"github.com/phillip-england/vii/vii"
+)
+
+// challengeLifetime is how long a user has to enter their code after the
+// password was accepted
+const challengeLifetime = 5 * time.Minute
+
+// maxChallengeAttempts is how many wrong codes one challenge takes before the
+// password has to be entered again, however many IPs the guesses come from
+const maxChallengeAttempts = 5
+
+// CreateChallenge remembers that user got the password right, so the second
+// login step knows who is entering a code. No session exists until that
+// step passes.
+func CreateChallenge(w http.ResponseWriter, r *http.Request, user *credentials.User) error {
+	database.DB.Exec("DELETE FROM LOGIN_CHALLENGE WHERE expires_at < ?", time.Now())
+
+	key, err := GenerateKey()
+	if err != nil {
+		return err
+	}
+	keyHash, err := hashSessionKey(r, key)
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(challengeLifetime)
+
+	_, err = database.DB.Exec("INSERT INTO LOGIN_CHALLENGE (key_hash, user_id, expires_at) VALUES (?, ?, ?)", keyHash, user.ID, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "login_challenge",
+		Value:    key,
+		Path:     "/login",
+		HttpOnly: true,
+		Secure:   secureCookies(r),
+		SameSite: http.SameSiteStrictMode,
+		Expires:  expiresAt,
+	})
+	return nil
+}
+
+// ChallengeUser returns the user with a pending second login step, or nil
+func ChallengeUser(r *http.Request) *credentials.User {
+	keyHash, ok := challengeKeyHash(r)
+	if !ok {
+		return nil
+	}
+
+	var userID string
+	var expiresAt time.Time
+	row := database.DB.QueryRow("SELECT user_id, expires_at FROM LOGIN_CHALLENGE WHERE key_hash = ? AND attempts < ?", keyHash, maxChallengeAttempts)
+	if err := row.Scan(&userID, &expiresAt); err != nil {
+		return nil
+	}
+	if time.Now().After(expiresAt) {
+		return nil
+	}
+
+	projectPath, _ := vii.GetContext(keys.ProjectPath, r).(string)
+	user, err := credentials.UserByID(projectPath, userID)
+	if err != nil {
+		return nil
+	}
+	return user
+}
+
+// FailChallenge counts a wrong code against the pending second login step
+// and ends the step once it has had maxChallengeAttempts. It reports whether
+// the step ended.
+func FailChallenge(w http.ResponseWriter, r *http.Request) (bool, error) {
+	keyHash, ok := challengeKeyHash(r)
+	if !ok {
+		return true, nil
+	}
+
+	var attempts int
+	row := database.DB.QueryRow("UPDATE LOGIN_CHALLENGE SET attempts = attempts + 1 WHERE key_hash = ? RETURNING attempts", keyHash)
+	if err := row.Scan(&attempts); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+	if attempts > 0 && attempts < maxChallengeAttempts {
+		return false, nil
+	}
+	return true, DeleteChallenge(w, r)
+}
+
+// DeleteChallenge ends the pending second login step
+func DeleteChallenge(w http.ResponseWriter, r *http.Request) error {
+	keyHash, ok := challengeKeyHash(r)
+	if !ok {
+		return nil
+	}
+
+	if _, err := database.DB.Exec("DELETE FROM LOGIN_CHALLENGE WHERE key_hash = ?", keyHash); err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "login_challenge",
+		Value:    "",
+		Path:     "/login",
+		HttpOnly: true,
+		Secure:   secureCookies(r),
+		SameSite: http.SameSiteStrictMode,
+		Expires:  time.Now().Add(-1 * time.Hour),
+		MaxAge:   -1,
+	})
+	return nil
+}
+
+// challengeKeyHash hashes r's login challenge cookie the way session keys are
+func challengeKeyHash(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie("login_challenge")
+	if err != nil {
+		return "", false
+	}
+	keyHash, err := hashSessionKey(r, cookie.Value)
+	return keyHash, err == nil
+}
@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// CSRFField is the form field the admin templates put the token in
+const CSRFField = "csrf_token"
+
+// CSRFHeader carries the token for requests made from scripts
+const CSRFHeader = "X-CSRF-Token"
+
+// CSRFToken returns the CSRF token of the session attached by
+// AuthenticateAndRefresh, or ""
+func CSRFToken(r *http.Request) string {
+	s, _ := r.Context().Value(sessionKey{}).(*session)
+	if s == nil {
+		return ""
+	}
+	return s.csrfToken
+}
+
+// ValidCSRF reports whether r carries its session's CSRF token, either in
+// the CSRFHeader or the CSRFField form value
+func ValidCSRF(r *http.Request) bool {
+	expected := CSRFToken(r)
+	if expected == "" {
+		return false
+	}
+	got := r.Header.Get(CSRFHeader)
+	if got == "" {
+		got = r.PostFormValue(CSRFField)
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(expected)) == 1
+}
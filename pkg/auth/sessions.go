@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/phillip-england/thispage/pkg/database"
+)
+
+// Session is a signed-in browser as shown on the sessions page
+type Session struct {
+	ID         int64
+	UserID     string
+	IPAddress  string
+	UserAgent  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+}
+
+// ListSessions returns the live sessions of userID, or of every user when
+// userID is empty, most recently used first
+func ListSessions(userID string) ([]Session, error) {
+	if err := Cleanup(); err != nil {
+		return nil, err
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT id, user_id, ip_address, user_agent, created_at, last_seen_at, expires_at
+		FROM session
+		WHERE ? = '' OR user_id = ?
+		ORDER BY last_seen_at DESC
+	`, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.ID, &s.UserID, &s.IPAddress, &s.UserAgent, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// CurrentSessionID returns the ID of the session attached by
+// AuthenticateAndRefresh, or 0
+func CurrentSessionID(r *http.Request) int64 {
+	s, _ := r.Context().Value(sessionKey{}).(*session)
+	if s == nil {
+		return 0
+	}
+	return s.id
+}
+
+// RevokeSession ends one session. A non-empty userID limits it to that
+// user's sessions. It reports whether a session was ended.
+func RevokeSession(id int64, userID string) (bool, error) {
+	result, err := database.DB.Exec("DELETE FROM session WHERE id = ? AND (? = '' OR user_id = ?)", id, userID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// RevokeUserSessions ends every session of userID
+func RevokeUserSessions(userID string) (int64, error) {
+	result, err := database.DB.Exec("DELETE FROM session WHERE user_id = ?", userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// RevokeAllSessions ends every session of every user
+func RevokeAllSessions() (int64, error) {
+	result, err := database.DB.Exec("DELETE FROM session")
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
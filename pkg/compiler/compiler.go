@@ -3,14 +3,51 @@ package compiler
 import (
 	"fmt"
 	"io/fs"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
+	"github.com/phillip-england/thispage/pkg/compress"
+	"github.com/phillip-england/thispage/pkg/config"
+	"github.com/phillip-england/thispage/pkg/httpcache"
+	"github.com/phillip-england/thispage/pkg/metrics"
+	"github.com/phillip-england/thispage/pkg/security"
 	"github.com/phillip-england/thispage/pkg/tokenizer"
 )
 
+// BuildError describes a compile failure with the source location that caused it
+type BuildError struct {
+	File    string `json:"file"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *BuildError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+	}
+	if e.File != "" {
+		return fmt.Sprintf("%s: %s", e.File, e.Message)
+	}
+	return e.Message
+}
+
+// newBuildError resolves the line number of offset within file
+func newBuildError(projectPath, file string, offset int, format string, args ...any) *BuildError {
+	buildErr := &BuildError{
+		File:    filepath.ToSlash(filepath.Clean(file)),
+		Message: fmt.Sprintf(format, args...),
+	}
+	content, err := os.ReadFile(filepath.Join(projectPath, file))
+	if err == nil && offset >= 0 && offset <= len(content) {
+		buildErr.Line = strings.Count(string(content[:offset]), "\n") + 1
+	}
+	return buildErr
+}
+
 var argsRegex = regexp.MustCompile(`(?:(\w+)=["'](.*?)["'])|(?:"(.*?)"|'(.*?)'|(\S+))`) // Corrected: escaped quotes within the regex string
 
 func parseArgs(raw string) (string, map[string]string) {
@@ -73,12 +110,12 @@ func compileRecursive(tokens []tokenizer.Token, projectPath string, blocks map[s
 				return "", err
 			}
 			if !strings.HasPrefix(cleanPath, cleanProject) {
-				return "", fmt.Errorf("include path outside project: %s", pathStr)
+				return "", newBuildError(projectPath, currentFile, token.Start, "include path outside project: %s", pathStr)
 			}
 
 			content, err := os.ReadFile(cleanPath)
 			if err != nil {
-				return "", fmt.Errorf("failed to read include %s: %w", pathStr, err)
+				return "", newBuildError(projectPath, currentFile, token.Start, "failed to read include %s: %v", pathStr, err)
 			}
 			subTokens := tokenizer.Tokenize(string(content))
             
@@ -138,12 +175,12 @@ func compileRecursive(tokens []tokenizer.Token, projectPath string, blocks map[s
 				return "", err
 			}
 			if !strings.HasPrefix(cleanPath, cleanProject) {
-				return "", fmt.Errorf("layout path outside project: %s", pathStr)
+				return "", newBuildError(projectPath, currentFile, token.Start, "layout path outside project: %s", pathStr)
 			}
 
 			lContent, err := os.ReadFile(cleanPath)
 			if err != nil {
-				return "", fmt.Errorf("failed to read layout %s: %w", pathStr, err)
+				return "", newBuildError(projectPath, currentFile, token.Start, "failed to read layout %s: %v", pathStr, err)
 			}
 			layoutTokens := tokenizer.Tokenize(string(lContent))
 			
@@ -197,28 +234,43 @@ func extractTokensUntil(tokens []tokenizer.Token, startIndex int, openType, clos
 	return captured, i
 }
 
-func Build(projectPath string) error {
+func Build(projectPath string) (err error) {
+	start := time.Now()
+	defer func() {
+		metrics.BuildDuration.ObserveSince(start)
+		if err != nil {
+			metrics.Builds.Inc("failure")
+		} else {
+			metrics.Builds.Inc("success")
+		}
+	}()
+
+	cfg, err := config.Load(projectPath)
+	if err != nil {
+		return err
+	}
+
 	templatesPath := filepath.Join(projectPath, "templates")
-	livePath := filepath.Join(projectPath, "live")
+	livePath := filepath.Join(projectPath, cfg.Build.OutputDir)
 	compiledFiles := make(map[string]string)
-	err := filepath.Walk(templatesPath, func(path string, info fs.FileInfo, err error) error {
+	err = filepath.Walk(templatesPath, func(path string, info fs.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 		if info.IsDir() {
 			if path == filepath.Join(templatesPath, "admin") {
-				return fmt.Errorf("the 'admin' directory is reserved")
+				return &BuildError{File: "templates/admin", Message: "the 'admin' directory is reserved"}
 			}
 			if path == filepath.Join(templatesPath, "static") {
-				return fmt.Errorf("the 'static' directory is reserved")
+				return &BuildError{File: "templates/static", Message: "the 'static' directory is reserved"}
 			}
 			return nil
 		}
 		if path == filepath.Join(templatesPath, "login.html") {
-			return fmt.Errorf("the 'login.html' file is reserved")
+			return &BuildError{File: "templates/login.html", Message: "the 'login.html' file is reserved"}
 		}
 		if path == filepath.Join(templatesPath, "admin.html") {
-			return fmt.Errorf("the 'admin.html' file is reserved")
+			return &BuildError{File: "templates/admin.html", Message: "the 'admin.html' file is reserved"}
 		}
 
 		if filepath.Ext(path) == ".html" {
@@ -245,7 +297,7 @@ func Build(projectPath string) error {
 
             // Inject Admin Mode Script
             adminScript := `
-<script>
+` + security.NonceScriptTag + `
   (function() {
     const params = new URLSearchParams(window.location.search);
     if (params.get('is_admin') === 'true') {
@@ -325,6 +377,7 @@ func Build(projectPath string) error {
 	if err := os.MkdirAll(livePath, 0755); err != nil {
 		return fmt.Errorf("failed to create live directory: %w", err)
 	}
+	hashes := make(map[string]string, len(compiledFiles))
 	for destPath, content := range compiledFiles {
 		if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
 			return fmt.Errorf("failed to create directory for %s: %w", destPath, err)
@@ -332,6 +385,54 @@ func Build(projectPath string) error {
 		if err := os.WriteFile(destPath, []byte(content), 0644); err != nil {
 			return fmt.Errorf("failed to write file %s: %w", destPath, err)
 		}
+		relPath, err := filepath.Rel(livePath, destPath)
+		if err != nil {
+			return err
+		}
+		hashes[filepath.ToSlash(relPath)] = httpcache.Hash([]byte(content))
+		if err := compress.WriteVariants([]byte(content), destPath); err != nil {
+			return err
+		}
 	}
+
+	if err := precompressStatic(projectPath, livePath); err != nil {
+		return err
+	}
+
+	// Content hashes back the ETags sent by the server
+	if err := httpcache.WriteManifest(projectPath, hashes); err != nil {
+		return err
+	}
+	slog.Debug("site built", "project", projectPath, "pages", len(compiledFiles), "duration", time.Since(start))
 	return nil
 }
+
+// precompressStatic writes .gz/.br variants of text assets in static/ under
+// <output>/static, where the server looks for them. The reserved
+// templates/static directory guarantees no page is compiled there.
+func precompressStatic(projectPath, livePath string) error {
+	staticPath := filepath.Join(projectPath, "static")
+	if _, err := os.Stat(staticPath); os.IsNotExist(err) {
+		return nil
+	}
+	return filepath.Walk(staticPath, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !compress.IsCompressible(path) {
+			return nil
+		}
+		relPath, err := filepath.Rel(staticPath, path)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := compress.WriteVariants(content, filepath.Join(livePath, "static", relPath)); err != nil {
+			return fmt.Errorf("failed to precompress %s: %w", path, err)
+		}
+		return nil
+	})
+}
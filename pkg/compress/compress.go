@@ -0,0 +1,347 @@
+package compress
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// MinSize is the smallest body worth compressing
+const MinSize = 256
+
+// Encodings we produce, in order of preference
+const (
+	Brotli = "br"
+	Gzip   = "gzip"
+)
+
+// extensions maps each encoding to the suffix of its precompressed file
+var extensions = map[string]string{
+	Brotli: ".br",
+	Gzip:   ".gz",
+}
+
+// IsCompressible reports whether a file with this name benefits from compression
+func IsCompressible(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".css", ".js", ".mjs", ".json", ".svg", ".xml", ".txt", ".map":
+		return true
+	}
+	return false
+}
+
+// isCompressibleType reports whether a Content-Type benefits from compression
+func isCompressibleType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(mediaType, "text/") {
+		return mediaType != "text/event-stream"
+	}
+	switch mediaType {
+	case "application/json", "application/javascript", "application/xml", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// WriteVariants writes destBase.br and destBase.gz next to each other
+func WriteVariants(content []byte, destBase string) error {
+	if len(content) < MinSize {
+		return nil
+	}
+
+	var gz bytes.Buffer
+	gzw, err := gzip.NewWriterLevel(&gz, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := gzw.Write(content); err != nil {
+		return err
+	}
+	if err := gzw.Close(); err != nil {
+		return err
+	}
+
+	var br bytes.Buffer
+	brw := brotli.NewWriterLevel(&br, brotli.BestCompression)
+	if _, err := brw.Write(content); err != nil {
+		return err
+	}
+	if err := brw.Close(); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destBase), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", destBase, err)
+	}
+	if err := os.WriteFile(destBase+extensions[Gzip], gz.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", destBase+extensions[Gzip], err)
+	}
+	if err := os.WriteFile(destBase+extensions[Brotli], br.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", destBase+extensions[Brotli], err)
+	}
+	return nil
+}
+
+// Negotiate picks the best encoding the client accepts, or "" for identity
+func Negotiate(r *http.Request) string {
+	accepted := map[string]float64{}
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if value, ok := strings.CutPrefix(param, "q="); ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		accepted[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range []string{Brotli, Gzip} {
+		q, ok := accepted[encoding]
+		if !ok {
+			q, ok = accepted["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// ServePrecompressed serves variantBase.br or variantBase.gz in place of
+// srcPath when the client accepts it and the variant is not older than the
+// source. It reports false when nothing suitable exists so the caller can
+// serve srcPath itself.
+func ServePrecompressed(w http.ResponseWriter, r *http.Request, srcPath, variantBase string) bool {
+	if r.Header.Get("Range") != "" {
+		return false
+	}
+	// Whatever we end up sending, the choice depended on Accept-Encoding
+	addVary(w.Header(), "Accept-Encoding")
+
+	encoding := Negotiate(r)
+	if encoding == "" {
+		return false
+	}
+
+	srcInfo, err := os.Stat(srcPath)
+	if err != nil {
+		return false
+	}
+	variantPath := variantBase + extensions[encoding]
+	variantInfo, err := os.Stat(variantPath)
+	if err != nil || variantInfo.ModTime().Before(srcInfo.ModTime()) {
+		return false
+	}
+
+	variant, err := os.Open(variantPath)
+	if err != nil {
+		return false
+	}
+	defer variant.Close()
+
+	header := w.Header()
+	if contentType := mime.TypeByExtension(filepath.Ext(srcPath)); contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	header.Set("Content-Encoding", encoding)
+	// Each representation gets its own strong validator
+	if etag := header.Get("ETag"); strings.HasPrefix(etag, `"`) {
+		header.Set("ETag", strings.TrimSuffix(etag, `"`)+"-"+encoding+`"`)
+	}
+	http.ServeContent(w, r, filepath.Base(srcPath), srcInfo.ModTime(), variant)
+	return true
+}
+
+// Middleware compresses responses on the fly when the handler did not already
+// pick an encoding, which covers the dynamic admin pages
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := Negotiate(r)
+		if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Range") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &responseWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// responseWriter buffers the first MinSize bytes, then decides whether to compress
+type responseWriter struct {
+	http.ResponseWriter
+	encoding    string
+	writer      io.WriteCloser
+	buf         []byte
+	status      int
+	wroteHeader bool
+}
+
+func (cw *responseWriter) WriteHeader(status int) {
+	if cw.wroteHeader || cw.status != 0 {
+		return
+	}
+	cw.status = status
+	if !bodyAllowed(status) {
+		cw.start(false)
+	}
+}
+
+func (cw *responseWriter) Write(p []byte) (int, error) {
+	if cw.wroteHeader {
+		if cw.writer != nil {
+			return cw.writer.Write(p)
+		}
+		return cw.ResponseWriter.Write(p)
+	}
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	cw.buf = append(cw.buf, p...)
+	if len(cw.buf) >= MinSize {
+		if err := cw.flushBuffer(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// flushBuffer sends the header and whatever has been buffered so far
+func (cw *responseWriter) flushBuffer(large bool) error {
+	if cw.Header().Get("Content-Type") == "" && len(cw.buf) > 0 {
+		cw.Header().Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	cw.start(large)
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if cw.writer != nil {
+		_, err := cw.writer.Write(buf)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+// start writes the real header, switching to a compressor when worthwhile
+func (cw *responseWriter) start(large bool) {
+	cw.wroteHeader = true
+	header := cw.Header()
+
+	compressible := large &&
+		bodyAllowed(cw.status) &&
+		cw.status != http.StatusPartialContent &&
+		header.Get("Content-Encoding") == "" &&
+		isCompressibleType(header.Get("Content-Type"))
+
+	if isCompressibleType(header.Get("Content-Type")) {
+		addVary(header, "Accept-Encoding")
+	}
+
+	if compressible {
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", cw.encoding)
+		// The bytes differ from the uncompressed representation
+		if etag := header.Get("ETag"); strings.HasPrefix(etag, `"`) {
+			header.Set("ETag", "W/"+etag)
+		}
+		switch cw.encoding {
+		case Brotli:
+			cw.writer = brotli.NewWriterLevel(cw.ResponseWriter, 5)
+		case Gzip:
+			cw.writer = gzip.NewWriter(cw.ResponseWriter)
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+}
+
+// Close sends anything still buffered and completes the compressed stream
+func (cw *responseWriter) Close() error {
+	if !cw.wroteHeader {
+		if cw.status == 0 && len(cw.buf) == 0 {
+			// The handler wrote nothing; net/http sends its default response
+			return nil
+		}
+		if err := cw.flushBuffer(false); err != nil {
+			return err
+		}
+	}
+	if cw.writer != nil {
+		return cw.writer.Close()
+	}
+	return nil
+}
+
+// Flush lets streaming handlers (such as live reload) push data immediately
+func (cw *responseWriter) Flush() {
+	if !cw.wroteHeader {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		cw.flushBuffer(len(cw.buf) >= MinSize)
+	}
+	if cw.writer != nil {
+		if flusher, ok := cw.writer.(interface{ Flush() error }); ok {
+			flusher.Flush()
+		}
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack supports handlers that take over the connection
+func (cw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := cw.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, errors.New("hijacking not supported")
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (cw *responseWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// addVary adds value to the Vary header unless it is already listed
+func addVary(header http.Header, value string) {
+	for _, existing := range header.Values("Vary") {
+		for _, field := range strings.Split(existing, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), value) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", value)
+}
+
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
@@ -0,0 +1,668 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"github.com/phillip-england/thispage/pkg/database"
+)
+
+// FileName is the name of the project configuration file
+const FileName = "thispage.toml"
+
+// Config holds the effective settings for a thispage project
+type Config struct {
+	Server    ServerConfig    `toml:"server"`
+	Build     BuildConfig     `toml:"build"`
+	Auth      AuthConfig      `toml:"auth"`
+	Database  DatabaseConfig  `toml:"database"`
+	Uploads   UploadsConfig   `toml:"uploads"`
+	Cache     CacheConfig     `toml:"cache"`
+	Security  SecurityConfig  `toml:"security"`
+	TLS       TLSConfig       `toml:"tls"`
+	Logging   LoggingConfig   `toml:"logging"`
+	Analytics AnalyticsConfig `toml:"analytics"`
+	RateLimit RateLimitConfig `toml:"rate_limit"`
+	Metrics   MetricsConfig   `toml:"metrics"`
+}
+
+// ServerConfig holds settings for the HTTP server
+type ServerConfig struct {
+	Port string `toml:"port"`
+	// BindAddress restricts the listener to one interface, e.g. "127.0.0.1"; empty listens on all
+	BindAddress string `toml:"bind_address"`
+	// AdminAddress moves /admin and /login to their own "host:port" listener
+	// (e.g. "127.0.0.1:9090"); the public listener then only serves the site
+	AdminAddress string `toml:"admin_address"`
+	// ShutdownTimeoutSeconds bounds how long in-flight requests may drain on shutdown
+	ShutdownTimeoutSeconds int `toml:"shutdown_timeout_seconds"`
+	// TrustedProxies lists the CIDRs (or single IPs) of reverse proxies whose
+	// X-Forwarded-For and Forwarded headers are believed
+	TrustedProxies []string `toml:"trusted_proxies"`
+}
+
+// TrustedProxyPrefixes parses TrustedProxies, skipping invalid entries
+// (Validate rejects them up front)
+func (s ServerConfig) TrustedProxyPrefixes() []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(s.TrustedProxies))
+	for _, entry := range s.TrustedProxies {
+		if prefix, err := parsePrefix(entry); err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// parsePrefix accepts a CIDR or a bare IP address
+func parsePrefix(entry string) (netip.Prefix, error) {
+	entry = strings.TrimSpace(entry)
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+}
+
+// BuildConfig holds settings for the compiler
+type BuildConfig struct {
+	OutputDir string `toml:"output_dir"`
+}
+
+// AuthConfig holds settings for admin sessions
+type AuthConfig struct {
+	SessionMinutes int `toml:"session_minutes"`
+	// AbsoluteSessionHours ends a session this long after sign-in, however active it is
+	AbsoluteSessionHours int `toml:"absolute_session_hours"`
+	// SameSite is the SameSite mode of the session cookie: "lax" or "strict"
+	SameSite string `toml:"same_site"`
+}
+
+// DatabaseConfig holds the capacity and rate limit thresholds for the SQLite tables
+type DatabaseConfig struct {
+	MaxLoginAttempts       int `toml:"max_login_attempts"`
+	MaxBlacklistEntries    int `toml:"max_blacklist_entries"`
+	MaxAdminMessages       int `toml:"max_admin_messages"`
+	MaxMessagesPerIPPerDay int `toml:"max_messages_per_ip_per_day"`
+	FailedAttemptThreshold int `toml:"failed_attempt_threshold"`
+	AttemptWindowSeconds   int `toml:"attempt_window_seconds"`
+	// BanMinutes is how long an IP's first login ban lasts; each repeat ban doubles it
+	BanMinutes int `toml:"ban_minutes"`
+	// MaxBanHours caps how long a repeat ban can grow
+	MaxBanHours int `toml:"max_ban_hours"`
+	// BanAllowlist lists the CIDRs (or single IPs) that are never banned
+	BanAllowlist []string `toml:"ban_allowlist"`
+}
+
+// BanAllowlistPrefixes parses BanAllowlist, skipping invalid entries
+// (Validate rejects them up front)
+func (d DatabaseConfig) BanAllowlistPrefixes() []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(d.BanAllowlist))
+	for _, entry := range d.BanAllowlist {
+		if prefix, err := parsePrefix(entry); err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// UploadsConfig holds the size limits for admin uploads
+type UploadsConfig struct {
+	MaxFileSizeMB int `toml:"max_file_size_mb"`
+	MaxZipSizeMB  int `toml:"max_zip_size_mb"`
+}
+
+// CacheConfig holds the HTTP caching policy for pages and static files
+type CacheConfig struct {
+	// Rules are checked in order; the first pattern matching the URL path wins
+	Rules []CacheRule `toml:"rules"`
+}
+
+// SecurityConfig holds the security headers added to every response
+type SecurityConfig struct {
+	// HSTSMaxAgeSeconds is sent as Strict-Transport-Security on HTTPS requests; 0 disables it
+	HSTSMaxAgeSeconds int    `toml:"hsts_max_age_seconds"`
+	ReferrerPolicy    string `toml:"referrer_policy"`
+	// FrameAncestors is the CSP frame-ancestors source list, e.g. "'self'" or "'none'"
+	FrameAncestors string `toml:"frame_ancestors"`
+	// ContentSecurityPolicy applies to the project's pages. Empty disables it.
+	// A nonce is added to script-src (or default-src) automatically so the
+	// admin-mode script keeps working.
+	ContentSecurityPolicy string `toml:"content_security_policy"`
+}
+
+// TLSConfig enables HTTPS, either from certificate files or through ACME
+type TLSConfig struct {
+	// CertFile and KeyFile are PEM files, relative to the project unless absolute
+	CertFile string `toml:"cert_file"`
+	KeyFile  string `toml:"key_file"`
+	// RedirectPort serves plain HTTP that redirects to HTTPS (and answers ACME
+	// http-01 challenges); empty disables it
+	RedirectPort string     `toml:"redirect_port"`
+	ACME         ACMEConfig `toml:"acme"`
+}
+
+// ACMEConfig obtains certificates automatically; it is enabled by listing Domains
+type ACMEConfig struct {
+	Domains []string `toml:"domains"`
+	Email   string   `toml:"email"`
+	// DirectoryURL defaults to Let's Encrypt; point it at a test server such as Pebble
+	DirectoryURL string `toml:"directory_url"`
+	// CacheDir stores issued certificates and the account key, relative to the project
+	CacheDir string `toml:"cache_dir"`
+	// CAFile is an extra root trusted when talking to the ACME server (Pebble's test CA)
+	CAFile string `toml:"ca_file"`
+}
+
+// Enabled reports whether the server speaks HTTPS
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" || len(t.ACME.Domains) > 0
+}
+
+// LoggingConfig controls the structured application and request log
+type LoggingConfig struct {
+	// Level is one of debug, info, warn or error
+	Level string `toml:"level"`
+	// Format is "text" or "json"
+	Format string `toml:"format"`
+	// File is relative to the project unless absolute; empty logs to stderr
+	File string `toml:"file"`
+	// MaxSizeMB rotates the file once it grows past this size
+	MaxSizeMB int `toml:"max_size_mb"`
+	// MaxBackups is how many rotated files are kept
+	MaxBackups int `toml:"max_backups"`
+}
+
+// AnalyticsConfig controls the built-in page view counter
+type AnalyticsConfig struct {
+	Enabled bool `toml:"enabled"`
+	// RetentionDays is how long daily counts are kept
+	RetentionDays int `toml:"retention_days"`
+}
+
+// MetricsConfig controls the Prometheus endpoint at /metrics
+type MetricsConfig struct {
+	Enabled bool `toml:"enabled"`
+	// AllowedIPs lists the CIDRs (or single IPs) that may scrape without a token
+	AllowedIPs []string `toml:"allowed_ips"`
+	// Token, when set, lets any client scrape with "Authorization: Bearer <token>"
+	Token string `toml:"token"`
+}
+
+// AllowedIPPrefixes parses AllowedIPs, skipping invalid entries
+// (Validate rejects them up front)
+func (m MetricsConfig) AllowedIPPrefixes() []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(m.AllowedIPs))
+	for _, entry := range m.AllowedIPs {
+		if prefix, err := parsePrefix(entry); err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// RateLimitConfig throttles each client IP with token buckets
+type RateLimitConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Persist keeps the buckets in data.db across restarts, so a restart does
+	// not hand every client a full bucket
+	Persist bool `toml:"persist"`
+	// Policies are checked in order; the first one matching the request
+	// applies. Requests matching none are not limited.
+	Policies []RateLimitPolicy `toml:"policies"`
+}
+
+// RateLimitPolicy gives every client a bucket of Burst requests, refilled at
+// RequestsPerMinute. Pattern uses the same syntax as cache rules.
+type RateLimitPolicy struct {
+	Name    string `toml:"name"`
+	Pattern string `toml:"pattern"`
+	// Methods limits the policy to these HTTP methods; empty matches all
+	Methods           []string `toml:"methods"`
+	RequestsPerMinute int      `toml:"requests_per_minute"`
+	Burst             int      `toml:"burst"`
+}
+
+// CacheRule sets Cache-Control for URL paths matching Pattern. "*" matches
+// within one path segment and a trailing "/**" matches everything below it.
+type CacheRule struct {
+	Pattern      string `toml:"pattern"`
+	CacheControl string `toml:"cache_control"`
+}
+
+var (
+	current   *Config
+	currentMu sync.RWMutex
+)
+
+// Default returns the built-in configuration used when no thispage.toml is present
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:                   "8080",
+			ShutdownTimeoutSeconds: 10,
+		},
+		Build: BuildConfig{
+			OutputDir: "live",
+		},
+		Auth: AuthConfig{
+			SessionMinutes:       15,
+			AbsoluteSessionHours: 24,
+			SameSite:             "lax",
+		},
+		Database: DatabaseConfig{
+			MaxLoginAttempts:       database.MaxLoginAttempts,
+			MaxBlacklistEntries:    database.MaxBlacklistEntries,
+			MaxAdminMessages:       database.MaxAdminMessages,
+			MaxMessagesPerIPPerDay: database.MaxMessagesPerIPPerDay,
+			FailedAttemptThreshold: database.FailedAttemptThreshold,
+			AttemptWindowSeconds:   database.AttemptWindowSeconds,
+			BanMinutes:             database.BanMinutes,
+			MaxBanHours:            database.MaxBanHours,
+		},
+		Uploads: UploadsConfig{
+			MaxFileSizeMB: 10,
+			MaxZipSizeMB:  50,
+		},
+		Cache: CacheConfig{
+			Rules: []CacheRule{
+				{Pattern: "/static/**", CacheControl: "public, max-age=3600"},
+				{Pattern: "/**", CacheControl: "no-cache"},
+			},
+		},
+		Security: SecurityConfig{
+			HSTSMaxAgeSeconds: 31536000,
+			ReferrerPolicy:    "strict-origin-when-cross-origin",
+			FrameAncestors:    "'self'",
+		},
+		Analytics: AnalyticsConfig{
+			Enabled:       true,
+			RetentionDays: database.AnalyticsRetentionDays,
+		},
+		RateLimit: RateLimitConfig{
+			Policies: []RateLimitPolicy{
+				{Name: "contact", Pattern: "/contact", Methods: []string{"POST"}, RequestsPerMinute: 6, Burst: 3},
+				{Name: "login", Pattern: "/login/**", Methods: []string{"POST"}, RequestsPerMinute: 20, Burst: 10},
+				{Name: "admin", Pattern: "/admin/**", RequestsPerMinute: 600, Burst: 200},
+				{Name: "static", Pattern: "/static/**", RequestsPerMinute: 600, Burst: 200},
+				{Name: "pages", Pattern: "/**", RequestsPerMinute: 120, Burst: 60},
+			},
+		},
+		Metrics: MetricsConfig{
+			AllowedIPs: []string{"127.0.0.1", "::1"},
+		},
+		Logging: LoggingConfig{
+			Level:      "info",
+			Format:     "text",
+			MaxSizeMB:  10,
+			MaxBackups: 5,
+		},
+		TLS: TLSConfig{
+			ACME: ACMEConfig{
+				DirectoryURL: "https://acme-v02.api.letsencrypt.org/directory",
+				CacheDir:     ".thispage/certs",
+			},
+		},
+	}
+}
+
+// Path returns the location of the configuration file for a project
+func Path(projectPath string) string {
+	return filepath.Join(projectPath, FileName)
+}
+
+// Load builds the effective configuration for a project: defaults, then
+// thispage.toml (if present), then environment variable overrides.
+// The project's .env is loaded first so its values count as environment.
+func Load(projectPath string) (*Config, error) {
+	_ = godotenv.Load(filepath.Join(projectPath, ".env"))
+
+	cfg := Default()
+
+	configPath := Path(projectPath)
+	if _, err := os.Stat(configPath); err == nil {
+		meta, err := toml.DecodeFile(configPath, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", FileName, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, key := range undecoded {
+				keys[i] = key.String()
+			}
+			return nil, fmt.Errorf("unknown keys in %s: %s", FileName, strings.Join(keys, ", "))
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s: %w", FileName, err)
+	}
+
+	if err := applyEnv(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// envOverride maps an environment variable onto a config field
+type envOverride struct {
+	Name  string
+	Apply func(cfg *Config, value string) error
+}
+
+// EnvOverrides lists every environment variable that can override thispage.toml
+var EnvOverrides = []envOverride{
+	{"THISPAGE_PORT", func(cfg *Config, v string) error { cfg.Server.Port = v; return nil }},
+	{"THISPAGE_BIND_ADDRESS", func(cfg *Config, v string) error { cfg.Server.BindAddress = v; return nil }},
+	{"THISPAGE_ADMIN_ADDRESS", func(cfg *Config, v string) error { cfg.Server.AdminAddress = v; return nil }},
+	{"THISPAGE_SHUTDOWN_TIMEOUT_SECONDS", intEnv(func(cfg *Config) *int { return &cfg.Server.ShutdownTimeoutSeconds })},
+	{"THISPAGE_TRUSTED_PROXIES", func(cfg *Config, v string) error { cfg.Server.TrustedProxies = splitList(v); return nil }},
+	{"THISPAGE_OUTPUT_DIR", func(cfg *Config, v string) error { cfg.Build.OutputDir = v; return nil }},
+	{"THISPAGE_SESSION_MINUTES", intEnv(func(cfg *Config) *int { return &cfg.Auth.SessionMinutes })},
+	{"THISPAGE_ABSOLUTE_SESSION_HOURS", intEnv(func(cfg *Config) *int { return &cfg.Auth.AbsoluteSessionHours })},
+	{"THISPAGE_SAME_SITE", func(cfg *Config, v string) error { cfg.Auth.SameSite = v; return nil }},
+	{"THISPAGE_MAX_LOGIN_ATTEMPTS", intEnv(func(cfg *Config) *int { return &cfg.Database.MaxLoginAttempts })},
+	{"THISPAGE_MAX_BLACKLIST_ENTRIES", intEnv(func(cfg *Config) *int { return &cfg.Database.MaxBlacklistEntries })},
+	{"THISPAGE_MAX_ADMIN_MESSAGES", intEnv(func(cfg *Config) *int { return &cfg.Database.MaxAdminMessages })},
+	{"THISPAGE_MAX_MESSAGES_PER_IP_PER_DAY", intEnv(func(cfg *Config) *int { return &cfg.Database.MaxMessagesPerIPPerDay })},
+	{"THISPAGE_FAILED_ATTEMPT_THRESHOLD", intEnv(func(cfg *Config) *int { return &cfg.Database.FailedAttemptThreshold })},
+	{"THISPAGE_ATTEMPT_WINDOW_SECONDS", intEnv(func(cfg *Config) *int { return &cfg.Database.AttemptWindowSeconds })},
+	{"THISPAGE_BAN_MINUTES", intEnv(func(cfg *Config) *int { return &cfg.Database.BanMinutes })},
+	{"THISPAGE_MAX_BAN_HOURS", intEnv(func(cfg *Config) *int { return &cfg.Database.MaxBanHours })},
+	{"THISPAGE_BAN_ALLOWLIST", func(cfg *Config, v string) error { cfg.Database.BanAllowlist = splitList(v); return nil }},
+	{"THISPAGE_MAX_FILE_SIZE_MB", intEnv(func(cfg *Config) *int { return &cfg.Uploads.MaxFileSizeMB })},
+	{"THISPAGE_MAX_ZIP_SIZE_MB", intEnv(func(cfg *Config) *int { return &cfg.Uploads.MaxZipSizeMB })},
+	{"THISPAGE_HSTS_MAX_AGE_SECONDS", intEnv(func(cfg *Config) *int { return &cfg.Security.HSTSMaxAgeSeconds })},
+	{"THISPAGE_REFERRER_POLICY", func(cfg *Config, v string) error { cfg.Security.ReferrerPolicy = v; return nil }},
+	{"THISPAGE_FRAME_ANCESTORS", func(cfg *Config, v string) error { cfg.Security.FrameAncestors = v; return nil }},
+	{"THISPAGE_CONTENT_SECURITY_POLICY", func(cfg *Config, v string) error { cfg.Security.ContentSecurityPolicy = v; return nil }},
+	{"THISPAGE_ANALYTICS_ENABLED", boolEnv(func(cfg *Config) *bool { return &cfg.Analytics.Enabled })},
+	{"THISPAGE_ANALYTICS_RETENTION_DAYS", intEnv(func(cfg *Config) *int { return &cfg.Analytics.RetentionDays })},
+	{"THISPAGE_RATE_LIMIT_ENABLED", boolEnv(func(cfg *Config) *bool { return &cfg.RateLimit.Enabled })},
+	{"THISPAGE_RATE_LIMIT_PERSIST", boolEnv(func(cfg *Config) *bool { return &cfg.RateLimit.Persist })},
+	{"THISPAGE_METRICS_ENABLED", boolEnv(func(cfg *Config) *bool { return &cfg.Metrics.Enabled })},
+	{"THISPAGE_METRICS_ALLOWED_IPS", func(cfg *Config, v string) error { cfg.Metrics.AllowedIPs = splitList(v); return nil }},
+	{"THISPAGE_METRICS_TOKEN", func(cfg *Config, v string) error { cfg.Metrics.Token = v; return nil }},
+	{"THISPAGE_LOG_LEVEL", func(cfg *Config, v string) error { cfg.Logging.Level = v; return nil }},
+	{"THISPAGE_LOG_FORMAT", func(cfg *Config, v string) error { cfg.Logging.Format = v; return nil }},
+	{"THISPAGE_LOG_FILE", func(cfg *Config, v string) error { cfg.Logging.File = v; return nil }},
+	{"THISPAGE_TLS_CERT_FILE", func(cfg *Config, v string) error { cfg.TLS.CertFile = v; return nil }},
+	{"THISPAGE_TLS_KEY_FILE", func(cfg *Config, v string) error { cfg.TLS.KeyFile = v; return nil }},
+	{"THISPAGE_TLS_REDIRECT_PORT", func(cfg *Config, v string) error { cfg.TLS.RedirectPort = v; return nil }},
+	{"THISPAGE_ACME_DOMAINS", func(cfg *Config, v string) error { cfg.TLS.ACME.Domains = splitList(v); return nil }},
+	{"THISPAGE_ACME_EMAIL", func(cfg *Config, v string) error { cfg.TLS.ACME.Email = v; return nil }},
+	{"THISPAGE_ACME_DIRECTORY_URL", func(cfg *Config, v string) error { cfg.TLS.ACME.DirectoryURL = v; return nil }},
+	{"THISPAGE_ACME_CA_FILE", func(cfg *Config, v string) error { cfg.TLS.ACME.CAFile = v; return nil }},
+}
+
+func intEnv(field func(cfg *Config) *int) func(cfg *Config, value string) error {
+	return func(cfg *Config, value string) error {
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return err
+		}
+		*field(cfg) = n
+		return nil
+	}
+}
+
+func boolEnv(field func(cfg *Config) *bool) func(cfg *Config, value string) error {
+	return func(cfg *Config, value string) error {
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return err
+		}
+		*field(cfg) = b
+		return nil
+	}
+}
+
+// splitList parses a comma-separated environment value
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func applyEnv(cfg *Config) error {
+	for _, override := range EnvOverrides {
+		value, ok := os.LookupEnv(override.Name)
+		if !ok || value == "" {
+			continue
+		}
+		if err := override.Apply(cfg, value); err != nil {
+			return fmt.Errorf("invalid value for %s: %w", override.Name, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks that every setting is within an acceptable range
+func (c *Config) Validate() error {
+	port, err := strconv.Atoi(c.Server.Port)
+	if err != nil || port <= 0 || port > 65535 {
+		return fmt.Errorf("server.port must be a number between 1 and 65535, got %q", c.Server.Port)
+	}
+
+	if c.Server.BindAddress != "" && c.Server.BindAddress != "localhost" {
+		if _, err := netip.ParseAddr(c.Server.BindAddress); err != nil {
+			return fmt.Errorf("server.bind_address must be an IP address or localhost, got %q", c.Server.BindAddress)
+		}
+	}
+
+	if c.Server.AdminAddress != "" {
+		host, adminPort, err := net.SplitHostPort(c.Server.AdminAddress)
+		if err != nil {
+			return fmt.Errorf("server.admin_address must be host:port, got %q", c.Server.AdminAddress)
+		}
+		if host != "" && host != "localhost" {
+			if _, err := netip.ParseAddr(host); err != nil {
+				return fmt.Errorf("server.admin_address host must be an IP address or localhost, got %q", host)
+			}
+		}
+		if n, err := strconv.Atoi(adminPort); err != nil || n <= 0 || n > 65535 {
+			return fmt.Errorf("server.admin_address port must be a number between 1 and 65535, got %q", adminPort)
+		}
+		if adminPort == c.Server.Port || adminPort == c.TLS.RedirectPort {
+			return fmt.Errorf("server.admin_address must use its own port")
+		}
+	}
+
+	for _, entry := range c.Server.TrustedProxies {
+		if _, err := parsePrefix(entry); err != nil {
+			return fmt.Errorf("server.trusted_proxies entry %q is not an IP address or CIDR", entry)
+		}
+	}
+
+	for _, entry := range c.Database.BanAllowlist {
+		if _, err := parsePrefix(entry); err != nil {
+			return fmt.Errorf("database.ban_allowlist entry %q is not an IP address or CIDR", entry)
+		}
+	}
+
+	for _, entry := range c.Metrics.AllowedIPs {
+		if _, err := parsePrefix(entry); err != nil {
+			return fmt.Errorf("metrics.allowed_ips entry %q is not an IP address or CIDR", entry)
+		}
+	}
+
+	switch c.Auth.SameSite {
+	case "lax", "strict":
+	default:
+		return fmt.Errorf("auth.same_site must be \"lax\" or \"strict\", got %q", c.Auth.SameSite)
+	}
+
+	outputDir := filepath.Clean(c.Build.OutputDir)
+	if c.Build.OutputDir == "" || filepath.IsAbs(outputDir) || outputDir == "." || strings.HasPrefix(outputDir, "..") || strings.ContainsAny(outputDir, `/\`) {
+		return fmt.Errorf("build.output_dir must be a single directory name inside the project, got %q", c.Build.OutputDir)
+	}
+	switch outputDir {
+	case "templates", "components", "layouts", "static", "data", ".thispage":
+		return fmt.Errorf("build.output_dir cannot be the reserved directory %q", outputDir)
+	}
+	c.Build.OutputDir = outputDir
+
+	positive := []struct {
+		name  string
+		value int
+	}{
+		{"server.shutdown_timeout_seconds", c.Server.ShutdownTimeoutSeconds},
+		{"auth.session_minutes", c.Auth.SessionMinutes},
+		{"auth.absolute_session_hours", c.Auth.AbsoluteSessionHours},
+		{"database.max_login_attempts", c.Database.MaxLoginAttempts},
+		{"database.max_blacklist_entries", c.Database.MaxBlacklistEntries},
+		{"database.max_admin_messages", c.Database.MaxAdminMessages},
+		{"database.max_messages_per_ip_per_day", c.Database.MaxMessagesPerIPPerDay},
+		{"database.failed_attempt_threshold", c.Database.FailedAttemptThreshold},
+		{"database.attempt_window_seconds", c.Database.AttemptWindowSeconds},
+		{"database.ban_minutes", c.Database.BanMinutes},
+		{"database.max_ban_hours", c.Database.MaxBanHours},
+		{"uploads.max_file_size_mb", c.Uploads.MaxFileSizeMB},
+		{"uploads.max_zip_size_mb", c.Uploads.MaxZipSizeMB},
+		{"logging.max_size_mb", c.Logging.MaxSizeMB},
+		{"analytics.retention_days", c.Analytics.RetentionDays},
+	}
+	for _, setting := range positive {
+		if setting.value <= 0 {
+			return fmt.Errorf("%s must be greater than zero, got %d", setting.name, setting.value)
+		}
+	}
+
+	for i, rule := range c.Cache.Rules {
+		if !strings.HasPrefix(rule.Pattern, "/") {
+			return fmt.Errorf("cache.rules[%d].pattern must start with '/', got %q", i, rule.Pattern)
+		}
+		if _, err := path.Match(strings.TrimSuffix(rule.Pattern, "/**"), "/"); err != nil {
+			return fmt.Errorf("cache.rules[%d].pattern is not a valid pattern: %w", i, err)
+		}
+		if strings.TrimSpace(rule.CacheControl) == "" {
+			return fmt.Errorf("cache.rules[%d].cache_control cannot be empty", i)
+		}
+	}
+
+	names := map[string]bool{}
+	for i, policy := range c.RateLimit.Policies {
+		if policy.Name == "" || names[policy.Name] {
+			return fmt.Errorf("rate_limit.policies[%d].name must be set and unique, got %q", i, policy.Name)
+		}
+		names[policy.Name] = true
+		if !strings.HasPrefix(policy.Pattern, "/") {
+			return fmt.Errorf("rate_limit.policies[%d].pattern must start with '/', got %q", i, policy.Pattern)
+		}
+		if _, err := path.Match(strings.TrimSuffix(policy.Pattern, "/**"), "/"); err != nil {
+			return fmt.Errorf("rate_limit.policies[%d].pattern is not a valid pattern: %w", i, err)
+		}
+		if policy.RequestsPerMinute <= 0 || policy.Burst <= 0 {
+			return fmt.Errorf("rate_limit.policies[%d] needs requests_per_minute and burst greater than zero", i)
+		}
+	}
+
+	switch strings.ToLower(c.Logging.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("logging.level must be debug, info, warn or error, got %q", c.Logging.Level)
+	}
+	switch c.Logging.Format {
+	case "text", "json":
+	default:
+		return fmt.Errorf("logging.format must be text or json, got %q", c.Logging.Format)
+	}
+	if c.Logging.MaxBackups < 0 {
+		return fmt.Errorf("logging.max_backups cannot be negative, got %d", c.Logging.MaxBackups)
+	}
+
+	if c.Security.HSTSMaxAgeSeconds < 0 {
+		return fmt.Errorf("security.hsts_max_age_seconds cannot be negative, got %d", c.Security.HSTSMaxAgeSeconds)
+	}
+	for name, value := range map[string]string{
+		"security.referrer_policy":         c.Security.ReferrerPolicy,
+		"security.frame_ancestors":         c.Security.FrameAncestors,
+		"security.content_security_policy": c.Security.ContentSecurityPolicy,
+	} {
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("%s cannot contain line breaks", name)
+		}
+	}
+	if strings.Contains(c.Security.FrameAncestors, ";") {
+		return fmt.Errorf("security.frame_ancestors must be a source list without ';', got %q", c.Security.FrameAncestors)
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("tls.cert_file and tls.key_file must be set together")
+	}
+	if c.TLS.CertFile != "" && len(c.TLS.ACME.Domains) > 0 {
+		return fmt.Errorf("tls.cert_file and tls.acme.domains cannot both be set")
+	}
+	if c.TLS.RedirectPort != "" {
+		if !c.TLS.Enabled() {
+			return fmt.Errorf("tls.redirect_port requires tls.cert_file or tls.acme.domains")
+		}
+		redirectPort, err := strconv.Atoi(c.TLS.RedirectPort)
+		if err != nil || redirectPort <= 0 || redirectPort > 65535 {
+			return fmt.Errorf("tls.redirect_port must be a number between 1 and 65535, got %q", c.TLS.RedirectPort)
+		}
+		if c.TLS.RedirectPort == c.Server.Port {
+			return fmt.Errorf("tls.redirect_port must differ from server.port")
+		}
+	}
+	if len(c.TLS.ACME.Domains) > 0 {
+		if !strings.HasPrefix(c.TLS.ACME.DirectoryURL, "https://") {
+			return fmt.Errorf("tls.acme.directory_url must be an https URL, got %q", c.TLS.ACME.DirectoryURL)
+		}
+		if c.TLS.ACME.CacheDir == "" {
+			return fmt.Errorf("tls.acme.cache_dir cannot be empty")
+		}
+		for _, domain := range c.TLS.ACME.Domains {
+			if domain == "" || strings.ContainsAny(domain, "/: ") {
+				return fmt.Errorf("tls.acme.domains contains an invalid host name %q", domain)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Encode renders the configuration as TOML
+func (c *Config) Encode() (string, error) {
+	var builder strings.Builder
+	if err := toml.NewEncoder(&builder).Encode(c); err != nil {
+		return "", err
+	}
+	return builder.String(), nil
+}
+
+// Set makes cfg the configuration returned by Get
+func Set(cfg *Config) {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	current = cfg
+}
+
+// Get returns the active configuration, or the defaults if none has been set
+func Get() *Config {
+	currentMu.RLock()
+	defer currentMu.RUnlock()
+	if current == nil {
+		return Default()
+	}
+	return current
+}
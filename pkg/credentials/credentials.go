@@ -5,12 +5,21 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/phillip-england/thispage/pkg/roles"
+	"github.com/phillip-england/thispage/pkg/totp"
 )
 
 type storedCredentials struct {
@@ -19,10 +28,50 @@ type storedCredentials struct {
 	Ciphertext string `json:"ciphertext"`
 }
 
-type plainCredentials struct {
+// currentVersion 3 stores a list of users; version 2 held a single user
+// with an argon2id hash and version 1 held the password itself
+const currentVersion = 3
+
+// User is an admin account; Role is one of the roles package's roles
+type User struct {
+	ID           string `json:"id"`
 	Username     string `json:"username"`
-	Password     string `json:"password"`
+	PasswordHash string `json:"password_hash"`
+	Role         string `json:"role"`
+	// TOTPSecret turns on two-factor login when set
+	TOTPSecret string `json:"totp_secret,omitempty"`
+	// TOTPCounter is the last time step used, so each code works only once
+	TOTPCounter int64 `json:"totp_counter,omitempty"`
+	// RecoveryCodes holds hashes of the unused recovery codes
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// TwoFactorEnabled reports whether the user must enter a code after the password
+func (u User) TwoFactorEnabled() bool {
+	return u.TOTPSecret != ""
+}
+
+type plainCredentials struct {
+	Users        []User `json:"users,omitempty"`
 	SessionToken string `json:"session_token"`
+
+	// The single user of version 1 and 2 files, moved into Users on load
+	Username     string `json:"username,omitempty"`
+	Password     string `json:"password,omitempty"`
+	PasswordHash string `json:"password_hash,omitempty"`
+}
+
+// mu keeps concurrent requests and CLI edits from interleaving
+var mu sync.Mutex
+
+// cached is the file last decrypted by load. Every authenticated request
+// reads the credentials, so the file is only decrypted again once it changes
+// on disk (guarded by mu).
+var cached struct {
+	path    string
+	modTime time.Time
+	size    int64
+	creds   plainCredentials
 }
 
 func projectSeedPath(projectPath string) string {
@@ -67,8 +116,13 @@ func EnsureProjectSeed(projectPath string) (string, error) {
 	return seed, nil
 }
 
+// Save replaces every user with a single owner and issues a fresh session
+// token, which signs out every existing session
 func Save(projectPath, username, password string) error {
-	if username == "" || password == "" {
+	if err := validateUsername(username); err != nil {
+		return err
+	}
+	if password == "" {
 		return fmt.Errorf("username and password are required")
 	}
 
@@ -82,15 +136,218 @@ func Save(projectPath, username, password string) error {
 		return err
 	}
 
-	return saveWithToken(projectPath, username, password, token, seed)
-}
+	owner, err := newUser(username, password, roles.Owner)
+	if err != nil {
+		return err
+	}
 
-func saveWithToken(projectPath, username, password, token, seed string) error {
-	payload := plainCredentials{
-		Username:     username,
-		Password:     password,
+	mu.Lock()
+	defer mu.Unlock()
+	return write(projectPath, seed, plainCredentials{
+		Users:        []User{owner},
 		SessionToken: token,
+	})
+}
+
+// AddUser creates a new admin user
+func AddUser(projectPath, username, password, role string) error {
+	if err := validateUsername(username); err != nil {
+		return err
+	}
+	if password == "" {
+		return fmt.Errorf("password is required")
+	}
+	if !roles.Valid(role) {
+		return fmt.Errorf("unknown role %q, expected one of %s", role, strings.Join(roles.All, ", "))
+	}
+	user, err := newUser(username, password, role)
+	if err != nil {
+		return err
+	}
+	return update(projectPath, func(creds *plainCredentials) error {
+		if findUser(creds.Users, username) >= 0 {
+			return fmt.Errorf("user %q already exists", username)
+		}
+		creds.Users = append(creds.Users, user)
+		return nil
+	})
+}
+
+// RemoveUser deletes an admin user; the last owner cannot be removed
+func RemoveUser(projectPath, username string) (string, error) {
+	var id string
+	err := update(projectPath, func(creds *plainCredentials) error {
+		i := findUser(creds.Users, username)
+		if i < 0 {
+			return fmt.Errorf("user %q does not exist", username)
+		}
+		if creds.Users[i].Role == roles.Owner && countOwners(creds.Users) == 1 {
+			return fmt.Errorf("cannot remove %q, the only owner", username)
+		}
+		id = creds.Users[i].ID
+		creds.Users = append(creds.Users[:i], creds.Users[i+1:]...)
+		return nil
+	})
+	return id, err
+}
+
+// SetRole changes a user's role; the last owner cannot be demoted
+func SetRole(projectPath, username, role string) (string, error) {
+	if !roles.Valid(role) {
+		return "", fmt.Errorf("unknown role %q, expected one of %s", role, strings.Join(roles.All, ", "))
+	}
+	var id string
+	err := update(projectPath, func(creds *plainCredentials) error {
+		i := findUser(creds.Users, username)
+		if i < 0 {
+			return fmt.Errorf("user %q does not exist", username)
+		}
+		if creds.Users[i].Role == roles.Owner && role != roles.Owner && countOwners(creds.Users) == 1 {
+			return fmt.Errorf("cannot demote %q, the only owner", username)
+		}
+		creds.Users[i].Role = role
+		id = creds.Users[i].ID
+		return nil
+	})
+	return id, err
+}
+
+// SetPassword changes a user's password and returns the user's ID, so the
+// caller can end that user's sessions
+func SetPassword(projectPath, username, password string) (string, error) {
+	if password == "" {
+		return "", fmt.Errorf("password is required")
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return "", err
+	}
+	var id string
+	err = update(projectPath, func(creds *plainCredentials) error {
+		i := findUser(creds.Users, username)
+		if i < 0 {
+			return fmt.Errorf("user %q does not exist", username)
+		}
+		creds.Users[i].PasswordHash = hash
+		id = creds.Users[i].ID
+		return nil
+	})
+	return id, err
+}
+
+// Users lists every admin user
+func Users(projectPath string) ([]User, error) {
+	creds, err := load(projectPath)
+	return creds.Users, err
+}
+
+// EnableTOTP turns on two-factor login for a user with a confirmed secret,
+// the time step of the code that confirmed it and the hashes of a fresh set
+// of recovery codes
+func EnableTOTP(projectPath, userID, secret string, counter int64, recoveryHashes []string) error {
+	return update(projectPath, func(creds *plainCredentials) error {
+		user := findUserByID(creds.Users, userID)
+		if user == nil {
+			return fmt.Errorf("user does not exist")
+		}
+		user.TOTPSecret = secret
+		user.TOTPCounter = counter
+		user.RecoveryCodes = recoveryHashes
+		return nil
+	})
+}
+
+// DisableTOTP turns off two-factor login for a user
+func DisableTOTP(projectPath, username string) (string, error) {
+	var id string
+	err := update(projectPath, func(creds *plainCredentials) error {
+		i := findUser(creds.Users, username)
+		if i < 0 {
+			return fmt.Errorf("user %q does not exist", username)
+		}
+		creds.Users[i].TOTPSecret = ""
+		creds.Users[i].TOTPCounter = 0
+		creds.Users[i].RecoveryCodes = nil
+		id = creds.Users[i].ID
+		return nil
+	})
+	return id, err
+}
+
+// VerifySecondFactor checks an authenticator code or, failing that, a
+// recovery code for the user. Used codes are remembered or consumed so they
+// cannot be replayed. Only an accepted code rewrites the credentials file.
+func VerifySecondFactor(projectPath, userID, code string) (bool, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	creds, seed, err := read(projectPath)
+	if err != nil {
+		return false, err
+	}
+	user := findUserByID(creds.Users, userID)
+	if user == nil || user.TOTPSecret == "" {
+		return false, nil
+	}
+
+	if counter, ok := totp.Validate(user.TOTPSecret, code, time.Now(), user.TOTPCounter); ok {
+		user.TOTPCounter = counter
+		return true, write(projectPath, seed, creds)
+	}
+	hash := totp.HashRecoveryCode(code)
+	for i, stored := range user.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(stored)) == 1 {
+			user.RecoveryCodes = append(user.RecoveryCodes[:i], user.RecoveryCodes[i+1:]...)
+			return true, write(projectPath, seed, creds)
+		}
+	}
+	return false, nil
+}
+
+// UserByID returns the user with the given ID, or nil if there is none
+func UserByID(projectPath, id string) (*User, error) {
+	creds, err := load(projectPath)
+	if err != nil {
+		return nil, err
+	}
+	return findUserByID(creds.Users, id), nil
+}
+
+// SessionToken returns the token every session is checked against
+func SessionToken(projectPath string) (string, error) {
+	creds, err := load(projectPath)
+	return creds.SessionToken, err
+}
+
+// Verify returns the user matching username and password, or nil. A password
+// hash is checked even when no username matches, so response timing does not
+// reveal which usernames exist.
+func Verify(projectPath, username, password string) (*User, error) {
+	creds, err := load(projectPath)
+	if err != nil {
+		return nil, err
+	}
+	var match *User
+	for i := range creds.Users {
+		if subtle.ConstantTimeCompare([]byte(username), []byte(creds.Users[i].Username)) == 1 {
+			match = &creds.Users[i]
+		}
+	}
+
+	hash := creds.Users[0].PasswordHash
+	if match != nil {
+		hash = match.PasswordHash
 	}
+	ok, err := VerifyPassword(password, hash)
+	if err != nil {
+		return nil, err
+	}
+	if match == nil || !ok {
+		return nil, nil
+	}
+	return match, nil
+}
+
+func write(projectPath, seed string, payload plainCredentials) error {
 	plaintext, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("failed to serialize credentials: %w", err)
@@ -114,7 +371,7 @@ func saveWithToken(projectPath, username, password, token, seed string) error {
 
 	ciphertext := gcm.Seal(nil, nonce, plaintext, nil)
 	encoded := storedCredentials{
-		Version:    1,
+		Version:    currentVersion,
 		Nonce:      base64.RawStdEncoding.EncodeToString(nonce),
 		Ciphertext: base64.RawStdEncoding.EncodeToString(ciphertext),
 	}
@@ -125,6 +382,7 @@ func saveWithToken(projectPath, username, password, token, seed string) error {
 	}
 
 	credPath := credentialsPath(projectPath)
+	cached.path = ""
 	if err := os.MkdirAll(filepath.Dir(credPath), 0700); err != nil {
 		return fmt.Errorf("failed to create credentials directory: %w", err)
 	}
@@ -135,72 +393,194 @@ func saveWithToken(projectPath, username, password, token, seed string) error {
 	return nil
 }
 
-func Load(projectPath string) (string, string, error) {
-	username, password, _, err := LoadWithToken(projectPath)
-	return username, password, err
+// load reads the credentials file. Callers get their own copy of Users.
+func load(projectPath string) (plainCredentials, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	credPath := credentialsPath(projectPath)
+	if info, err := os.Stat(credPath); err == nil && cached.path == credPath &&
+		info.ModTime().Equal(cached.modTime) && info.Size() == cached.size {
+		creds := cached.creds
+		creds.Users = slices.Clone(creds.Users)
+		return creds, nil
+	}
+
+	creds, _, err := read(projectPath)
+	if err != nil {
+		return creds, err
+	}
+	// read may have upgraded the file, so stat it afterwards
+	if info, err := os.Stat(credPath); err == nil {
+		cached.path, cached.modTime, cached.size = credPath, info.ModTime(), info.Size()
+		cached.creds = creds
+		cached.creds.Users = slices.Clone(creds.Users)
+	}
+	return creds, nil
+}
+
+// update applies change to the credentials file and writes it back
+func update(projectPath string, change func(*plainCredentials) error) error {
+	mu.Lock()
+	defer mu.Unlock()
+	creds, seed, err := read(projectPath)
+	if err != nil {
+		return err
+	}
+	if err := change(&creds); err != nil {
+		return err
+	}
+	return write(projectPath, seed, creds)
 }
 
-func LoadWithToken(projectPath string) (string, string, string, error) {
+// read decrypts the credentials file and upgrades older versions on first
+// read: the password of a version 1 file is hashed, and the single user of
+// version 1 and 2 files becomes the owner (must hold mu)
+func read(projectPath string) (plainCredentials, string, error) {
+	var decoded plainCredentials
 	seed, err := ProjectSeed(projectPath)
 	if err != nil {
-		return "", "", "", err
+		return decoded, "", err
 	}
 
 	credPath := credentialsPath(projectPath)
 	data, err := os.ReadFile(credPath)
 	if err != nil {
-		return "", "", "", fmt.Errorf("failed to read credentials: %w", err)
+		return decoded, seed, fmt.Errorf("failed to read credentials: %w", err)
 	}
 
 	var stored storedCredentials
 	if err := json.Unmarshal(data, &stored); err != nil {
-		return "", "", "", fmt.Errorf("failed to parse credentials: %w", err)
+		return decoded, seed, fmt.Errorf("failed to parse credentials: %w", err)
 	}
 	if stored.Ciphertext == "" || stored.Nonce == "" {
-		return "", "", "", fmt.Errorf("credentials file is missing required fields")
+		return decoded, seed, fmt.Errorf("credentials file is missing required fields")
 	}
 
 	nonce, err := base64.RawStdEncoding.DecodeString(stored.Nonce)
 	if err != nil {
-		return "", "", "", fmt.Errorf("failed to decode nonce: %w", err)
+		return decoded, seed, fmt.Errorf("failed to decode nonce: %w", err)
 	}
 	ciphertext, err := base64.RawStdEncoding.DecodeString(stored.Ciphertext)
 	if err != nil {
-		return "", "", "", fmt.Errorf("failed to decode ciphertext: %w", err)
+		return decoded, seed, fmt.Errorf("failed to decode ciphertext: %w", err)
 	}
 
 	key := sha256.Sum256([]byte(seed))
 	block, err := aes.NewCipher(key[:])
 	if err != nil {
-		return "", "", "", fmt.Errorf("failed to create cipher: %w", err)
+		return decoded, seed, fmt.Errorf("failed to create cipher: %w", err)
 	}
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
-		return "", "", "", fmt.Errorf("failed to create gcm: %w", err)
+		return decoded, seed, fmt.Errorf("failed to create gcm: %w", err)
 	}
 
 	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
 	if err != nil {
-		return "", "", "", fmt.Errorf("failed to decrypt credentials: %w", err)
+		return decoded, seed, fmt.Errorf("failed to decrypt credentials: %w", err)
 	}
 
-	var decoded plainCredentials
 	if err := json.Unmarshal(plaintext, &decoded); err != nil {
-		return "", "", "", fmt.Errorf("failed to parse decrypted credentials: %w", err)
+		return decoded, seed, fmt.Errorf("failed to parse decrypted credentials: %w", err)
 	}
 
+	changed := false
+	if decoded.Username != "" {
+		hash := decoded.PasswordHash
+		if hash == "" {
+			if decoded.Password == "" {
+				return decoded, seed, fmt.Errorf("credentials file has no password")
+			}
+			if hash, err = HashPassword(decoded.Password); err != nil {
+				return decoded, seed, err
+			}
+		}
+		id, err := newUserID()
+		if err != nil {
+			return decoded, seed, err
+		}
+		decoded.Users = append(decoded.Users, User{ID: id, Username: decoded.Username, PasswordHash: hash, Role: roles.Owner})
+		// Never keep the plaintext around, even in memory
+		decoded.Username, decoded.Password, decoded.PasswordHash = "", "", ""
+		changed = true
+	}
+	if len(decoded.Users) == 0 {
+		return decoded, seed, fmt.Errorf("credentials file has no users")
+	}
 	if decoded.SessionToken == "" {
 		token, err := GenerateSessionToken()
 		if err != nil {
-			return "", "", "", err
-		}
-		if err := saveWithToken(projectPath, decoded.Username, decoded.Password, token, seed); err != nil {
-			return "", "", "", err
+			return decoded, seed, err
 		}
 		decoded.SessionToken = token
+		changed = true
+	}
+	if changed || stored.Version < currentVersion {
+		if err := write(projectPath, seed, decoded); err != nil {
+			return decoded, seed, err
+		}
+	}
+
+	return decoded, seed, nil
+}
+
+func newUser(username, password, role string) (User, error) {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+	id, err := newUserID()
+	if err != nil {
+		return User{}, err
+	}
+	return User{ID: id, Username: username, PasswordHash: hash, Role: role}, nil
+}
+
+func newUserID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate user id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func validateUsername(username string) error {
+	if username == "" {
+		return fmt.Errorf("username is required")
+	}
+	if len(username) > 64 || strings.ContainsFunc(username, unicode.IsSpace) {
+		return fmt.Errorf("username must be at most 64 characters without spaces")
+	}
+	return nil
+}
+
+func findUser(users []User, username string) int {
+	for i, user := range users {
+		if user.Username == username {
+			return i
+		}
 	}
+	return -1
+}
+
+func findUserByID(users []User, id string) *User {
+	for i := range users {
+		if users[i].ID == id {
+			return &users[i]
+		}
+	}
+	return nil
+}
 
-	return decoded.Username, decoded.Password, decoded.SessionToken, nil
+func countOwners(users []User) int {
+	count := 0
+	for _, user := range users {
+		if user.Role == roles.Owner {
+			count++
+		}
+	}
+	return count
 }
 
 func credentialsPath(projectPath string) string {
@@ -3,12 +3,15 @@ package database
 import (
 	"database/sql"
 	"path/filepath"
+	"time"
 
 	_ "modernc.org/sqlite"
 )
 
 var DB *sql.DB
 
+// The limits below are the defaults; projects can override them in thispage.toml
+
 // MaxLoginAttempts is the maximum number of entries in the LOGIN_ATTEMPT table
 const MaxLoginAttempts = 1000
 
@@ -27,7 +30,19 @@ const FailedAttemptThreshold = 5
 // AttemptWindowSeconds is the time window (in seconds) for counting consecutive failures
 const AttemptWindowSeconds = 60
 
-func Init(projectPath string) error {
+// BanMinutes is how long the first login ban of an IP lasts; repeat bans double it
+const BanMinutes = 15
+
+// MaxBanHours caps how long a repeat login ban can grow
+const MaxBanHours = 24
+
+// AnalyticsRetentionDays is how long daily PAGE_VIEW rows are kept
+const AnalyticsRetentionDays = 90
+
+// Init opens the project's database and brings its tables up to date.
+// banMinutes is the configured database.ban_minutes, the length given to bans
+// from before bans expired.
+func Init(projectPath string, banMinutes int) error {
 	dbPath := filepath.Join(projectPath, "data.db")
 	var err error
 	DB, err = sql.Open("sqlite", dbPath)
@@ -35,14 +50,70 @@ func Init(projectPath string) error {
 		return err
 	}
 
+	// Sessions and login challenges used to store their keys in the clear.
+	// They are short-lived, so older tables are dropped rather than migrated
+	// and everyone signs in again once.
+	for _, table := range []string{"session", "LOGIN_CHALLENGE"} {
+		if err := dropWithoutColumn(table, "key_hash"); err != nil {
+			return err
+		}
+	}
+
 	query := `
     CREATE TABLE IF NOT EXISTS session (
         id INTEGER PRIMARY KEY AUTOINCREMENT,
-        key TEXT NOT NULL,
-        token TEXT NOT NULL,
+        key_hash TEXT NOT NULL UNIQUE,
+        user_id TEXT NOT NULL,
+        role TEXT NOT NULL,
+        csrf_token TEXT NOT NULL,
+        ip_address TEXT NOT NULL DEFAULT '',
+        user_agent TEXT NOT NULL DEFAULT '',
+        created_at DATETIME NOT NULL,
+        last_seen_at DATETIME NOT NULL,
         expires_at DATETIME NOT NULL
     );
 
+    CREATE TABLE IF NOT EXISTS LOGIN_CHALLENGE (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        key_hash TEXT NOT NULL UNIQUE,
+        user_id TEXT NOT NULL,
+        expires_at DATETIME NOT NULL,
+        attempts INTEGER NOT NULL DEFAULT 0
+    );
+
+    CREATE TABLE IF NOT EXISTS API_TOKEN (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        user_id TEXT NOT NULL,
+        name TEXT NOT NULL,
+        token_hash TEXT NOT NULL UNIQUE,
+        hint TEXT NOT NULL,
+        scopes TEXT NOT NULL,
+        created_at DATETIME NOT NULL,
+        last_used_at DATETIME
+    );
+
+    CREATE TABLE IF NOT EXISTS AUDIT_LOG (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        actor TEXT NOT NULL,
+        ip_address TEXT NOT NULL,
+        action TEXT NOT NULL,
+        target TEXT NOT NULL,
+        created_at DATETIME NOT NULL
+    );
+
+    CREATE INDEX IF NOT EXISTS idx_audit_log_created ON AUDIT_LOG(created_at);
+
+    -- The audit log is append-only
+    CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON AUDIT_LOG
+    BEGIN
+        SELECT RAISE(ABORT, 'AUDIT_LOG is append-only');
+    END;
+
+    CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON AUDIT_LOG
+    BEGIN
+        SELECT RAISE(ABORT, 'AUDIT_LOG is append-only');
+    END;
+
     CREATE TABLE IF NOT EXISTS LOGIN_ATTEMPT (
         id INTEGER PRIMARY KEY AUTOINCREMENT,
         ip_address TEXT NOT NULL,
@@ -56,11 +127,21 @@ func Init(projectPath string) error {
     CREATE TABLE IF NOT EXISTS LOGIN_BLACKLIST (
         id INTEGER PRIMARY KEY AUTOINCREMENT,
         ip_address TEXT NOT NULL UNIQUE,
-        blacklisted_at DATETIME NOT NULL
+        blacklisted_at DATETIME NOT NULL,
+        expires_at DATETIME,
+        ban_count INTEGER NOT NULL DEFAULT 1
     );
 
     CREATE INDEX IF NOT EXISTS idx_blacklist_ip ON LOGIN_BLACKLIST(ip_address);
 
+    CREATE TABLE IF NOT EXISTS RATE_LIMIT_BUCKET (
+        policy TEXT NOT NULL,
+        client TEXT NOT NULL,
+        tokens REAL NOT NULL,
+        updated_at DATETIME NOT NULL,
+        PRIMARY KEY (policy, client)
+    );
+
     CREATE TABLE IF NOT EXISTS ADMIN_MESSAGE (
         id INTEGER PRIMARY KEY AUTOINCREMENT,
         ip_address TEXT NOT NULL,
@@ -72,7 +153,72 @@ func Init(projectPath string) error {
 
     CREATE INDEX IF NOT EXISTS idx_admin_message_ip ON ADMIN_MESSAGE(ip_address);
     CREATE INDEX IF NOT EXISTS idx_admin_message_created ON ADMIN_MESSAGE(created_at);
+
+    CREATE TABLE IF NOT EXISTS PAGE_VIEW (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        day TEXT NOT NULL,
+        path TEXT NOT NULL,
+        referrer_host TEXT NOT NULL DEFAULT '',
+        agent_class TEXT NOT NULL,
+        views INTEGER NOT NULL DEFAULT 0,
+        UNIQUE(day, path, referrer_host, agent_class)
+    );
+
+    CREATE INDEX IF NOT EXISTS idx_page_view_day ON PAGE_VIEW(day);
     `
-	_, err = DB.Exec(query)
+	if _, err = DB.Exec(query); err != nil {
+		return err
+	}
+
+	// Columns added after a table was first released
+	columns := []struct{ table, column, definition string }{
+		{"LOGIN_BLACKLIST", "expires_at", "DATETIME"},
+		{"LOGIN_BLACKLIST", "ban_count", "INTEGER NOT NULL DEFAULT 1"},
+		{"LOGIN_CHALLENGE", "attempts", "INTEGER NOT NULL DEFAULT 0"},
+	}
+	for _, c := range columns {
+		if err := addColumn(c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+
+	// Bans used to be permanent. They now run out one first ban after the
+	// upgrade and count as a first ban, so a repeat offender gets a longer one.
+	firstBanEnds := time.Now().Add(time.Duration(banMinutes) * time.Minute)
+	_, err = DB.Exec("UPDATE LOGIN_BLACKLIST SET expires_at = ? WHERE expires_at IS NULL", firstBanEnds)
+	return err
+}
+
+// dropWithoutColumn drops table if it exists but lacks column
+func dropWithoutColumn(table, column string) error {
+	var tables, columns int
+	err := DB.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&tables)
+	if err != nil || tables == 0 {
+		return err
+	}
+	err = DB.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&columns)
+	if err != nil || columns > 0 {
+		return err
+	}
+	_, err = DB.Exec("DROP TABLE " + table)
+	return err
+}
+
+// addColumn adds a column to an existing table unless it is already there
+func addColumn(table, column, definition string) error {
+	var count int
+	err := DB.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+	_, err = DB.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
 	return err
 }
+
+// Close closes the database connection opened by Init
+func Close() error {
+	if DB == nil {
+		return nil
+	}
+	return DB.Close()
+}
@@ -309,6 +309,11 @@ const docsHTML = `<!DOCTYPE html>
                     <td><code>&lt;path&gt;</code></td>
                     <td>Watches for file changes and rebuilds, but does not serve HTTP.</td>
                 </tr>
+                <tr>
+                    <td><code>sites</code></td>
+                    <td><code>&lt;sites-file&gt; [--port] [--trusted-proxies]</code></td>
+                    <td>Serves several projects from one port, routed by Host header. Each <code>[[site]]</code> lists its <code>hosts</code> and project <code>path</code>; edits to the file apply without a restart. Sites trust the proxies given with <code>--trusted-proxies</code> instead of their own <code>server.trusted_proxies</code>, and cannot enable <code>[tls]</code>.</td>
+                </tr>
                 <tr>
                     <td><code>mount</code></td>
                     <td><code>&lt;path&gt; &lt;user&gt; &lt;pass&gt;</code></td>
@@ -317,7 +322,22 @@ const docsHTML = `<!DOCTYPE html>
                 <tr>
                     <td><code>credentials</code></td>
                     <td><code>&lt;path&gt;</code></td>
-                    <td>Displays the current encrypted admin credentials and session key.</td>
+                    <td>Lists the admin users. Passwords are stored as argon2id hashes and cannot be shown; use <code>credentials set</code> to change them.</td>
+                </tr>
+                <tr>
+                    <td><code>users</code></td>
+                    <td><code>list|add|remove|role|reset-2fa &lt;path&gt; ...</code></td>
+                    <td>Manages admin users. Roles: <code>owner</code> (everything), <code>editor</code> (templates and components only) and <code>viewer</code> (messages and analytics, read only). <code>add</code> takes <code>--role</code>; <code>reset-2fa</code> turns off two-factor login for a user who lost their device.</td>
+                </tr>
+                <tr>
+                    <td><code>sessions</code></td>
+                    <td><code>list|revoke-all &lt;path&gt;</code></td>
+                    <td>Lists active admin sessions, or signs every user out of every browser. Admins can also revoke sessions from the Sessions page.</td>
+                </tr>
+                <tr>
+                    <td><code>unban</code></td>
+                    <td><code>&lt;path&gt; &lt;ip&gt;</code></td>
+                    <td>Lifts a login ban on an IP and forgets its earlier bans. Owners can also do this from the Bans page.</td>
                 </tr>
             </tbody>
         </table>
@@ -402,9 +422,14 @@ const docsHTML = `<!DOCTYPE html>
         <h2>Security & Auth</h2>
         <p>Security is built into the core:</p>
         <ul>
-            <li><strong>Encryption:</strong> Credentials are stored using AES-GCM encryption with a project-specific seed.</li>
-            <li><strong>Rate Limiting:</strong> Login attempts are tracked by IP. 5 failed attempts trigger a temporary block. Excessive failures trigger a permanent blacklist.</li>
-            <li><strong>Session Management:</strong> Secure, HTTP-only cookies are used for session management.</li>
+            <li><strong>Password Hashing:</strong> Passwords are stored only as argon2id hashes and checked in constant time; the credentials file is additionally AES-GCM encrypted with a project-specific seed. Older files holding the password itself are upgraded on first use.</li>
+            <li><strong>Two-Factor Login:</strong> Each user can enable TOTP codes (RFC 6238) from the Account page by scanning a QR code with an authenticator app. Ten single-use recovery codes are shown once; only their hashes are stored. Wrong codes count toward the same login lockout as wrong passwords.</li>
+            <li><strong>Rate Limiting:</strong> Login attempts are tracked by IP. 5 failed attempts within a minute ban the IP for <code>database.ban_minutes</code> (15 by default). Each repeat ban lasts twice as long as the one before, up to <code>database.max_ban_hours</code>; an IP that stays clean that long after its last ban starts over. IPs and CIDRs in <code>database.ban_allowlist</code> are never banned. Owners can see and lift bans at <code>/admin/bans</code>, or run <code>thispage unban</code>.</li>
+            <li><strong>Request Limits:</strong> Off by default; set <code>rate_limit.enabled = true</code> (and <code>server.trusted_proxies</code> when behind a proxy) to turn them on. Every request is counted against the first <code>[[rate_limit.policies]]</code> entry matching its path and method. Each IP gets <code>burst</code> requests up front, refilled at <code>requests_per_minute</code>; once they run out the server answers <code>429 Too Many Requests</code> with a <code>Retry-After</code> header. Defaults cover the contact form, login, the admin, static files and pages. <code>/healthz</code>, <code>/readyz</code> and <code>/metrics</code> are never limited. Set <code>rate_limit.persist</code> to keep counts across restarts.</li>
+            <li><strong>Session Management:</strong> Secure, HTTP-only cookies are used for session management. Cookies are marked <code>Secure</code> whenever the request came over HTTPS, including HTTPS ended at one of <code>server.trusted_proxies</code> that sends <code>X-Forwarded-Proto: https</code>. The session cookie is <code>SameSite=Lax</code> by default; set <code>auth.same_site = "strict"</code> to tighten it. Sessions slide forward with use for <code>auth.session_minutes</code> but end <code>auth.absolute_session_hours</code> after sign-in regardless. Each session records its IP, browser, sign-in and last-seen times. Session keys are stored only as HMAC-SHA256 hashes keyed by a secret from the encrypted credentials file and are bound to the user they were issued to. A user's sessions end when their role or password changes or their two-factor login is reset; turning two-factor login on or off gives the current session a new key and CSRF token and ends the user's other sessions.</li>
+            <li><strong>CSRF Protection:</strong> Each session gets its own CSRF token. Every admin form carries it and any admin request other than a GET is rejected without it. Scripts can send it in the <code>X-CSRF-Token</code> header.</li>
+            <li><strong>API Tokens:</strong> Users create personal API tokens under Account &rarr; API Tokens, choosing from the scopes <code>files:read</code>, <code>files:write</code>, <code>build</code>, <code>messages:read</code> and <code>export</code> that their role allows. A token is shown once and stored only as a SHA-256 hash. Send it as <code>Authorization: Bearer &lt;token&gt;</code> to the JSON API under <code>/admin/api/v1</code>: <code>GET files</code>, <code>GET</code>/<code>PUT files/content?path=</code>, <code>POST files/rename</code>, <code>DELETE files?path=</code>, <code>POST build</code>, <code>GET messages</code> and <code>GET export</code>. The API applies the same path and file type rules as the file manager, and a token stops working when its user loses the role or is removed.</li>
+            <li><strong>Audit Log:</strong> Every admin change is recorded with who made it, their IP, the action, the file or user it touched and when: file saves, creates, renames, deletes and uploads, zip deploys, builds, message deletions, logins and logouts, two-factor, session and API token changes, and user and password changes made with the CLI. The log is append-only; the database refuses to update or delete its rows. Owners can browse and filter it at <code>/admin/audit</code> and export it as CSV or JSON.</li>
             <li><strong>Path Traversal Protection:</strong> The file system router and admin endpoints strictly validate paths to ensure they stay within the project root.</li>
         </ul>
     </section>
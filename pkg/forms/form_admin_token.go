@@ -0,0 +1,34 @@
+package forms
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type FormAdminTokenData struct {
+	// Name tells the user's tokens apart
+	Name string
+	// Scopes are the checked scope boxes
+	Scopes []string
+}
+
+type FormAdminToken struct{}
+
+func (FormAdminToken) Validate(r *http.Request) (FormAdminTokenData, error) {
+	if err := r.ParseForm(); err != nil {
+		return FormAdminTokenData{}, err
+	}
+	name := strings.TrimSpace(r.Form.Get("name"))
+	if name == "" || len(name) > 64 {
+		return FormAdminTokenData{}, fmt.Errorf("name must be 1 to 64 characters")
+	}
+	scopes := r.Form["scope"]
+	if len(scopes) == 0 {
+		return FormAdminTokenData{}, fmt.Errorf("choose at least one scope")
+	}
+	return FormAdminTokenData{
+		Name:   name,
+		Scopes: scopes,
+	}, nil
+}
@@ -0,0 +1,51 @@
+package forms
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type FormAdminTOTPData struct {
+	// Code is a six digit authenticator code or a recovery code
+	Code string
+}
+
+type FormAdminTOTP struct{}
+
+func (FormAdminTOTP) Validate(r *http.Request) (FormAdminTOTPData, error) {
+	if err := r.ParseForm(); err != nil {
+		return FormAdminTOTPData{}, err
+	}
+	code := strings.TrimSpace(r.Form.Get("code"))
+	if code == "" || len(code) > 32 {
+		return FormAdminTOTPData{}, fmt.Errorf("code is required")
+	}
+	return FormAdminTOTPData{
+		Code: code,
+	}, nil
+}
+
+type FormAdminTOTPEnableData struct {
+	// Secret is the secret shown to the user while enrolling
+	Secret string
+	// Code proves the authenticator app was set up with Secret
+	Code string
+}
+
+type FormAdminTOTPEnable struct{}
+
+func (FormAdminTOTPEnable) Validate(r *http.Request) (FormAdminTOTPEnableData, error) {
+	code, err := FormAdminTOTP{}.Validate(r)
+	if err != nil {
+		return FormAdminTOTPEnableData{}, err
+	}
+	secret := strings.TrimSpace(r.Form.Get("secret"))
+	if secret == "" || len(secret) > 64 {
+		return FormAdminTOTPEnableData{}, fmt.Errorf("secret is required")
+	}
+	return FormAdminTOTPEnableData{
+		Secret: secret,
+		Code:   code.Code,
+	}, nil
+}
@@ -0,0 +1,168 @@
+package httpcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phillip-england/thispage/pkg/compress"
+	"github.com/phillip-england/thispage/pkg/config"
+)
+
+// ManifestPath returns where compiler.Build records the content hash of each output file
+func ManifestPath(projectPath string) string {
+	return filepath.Join(projectPath, ".thispage", "manifest.json")
+}
+
+// Hash returns the hex digest used for strong ETags
+func Hash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:16])
+}
+
+// WriteManifest stores hashes keyed by slash-separated path relative to the output dir
+func WriteManifest(projectPath string, hashes map[string]string) error {
+	data, err := json.MarshalIndent(hashes, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize manifest: %w", err)
+	}
+	manifestPath := ManifestPath(projectPath)
+	if err := os.MkdirAll(filepath.Dir(manifestPath), 0700); err != nil {
+		return fmt.Errorf("failed to create manifest directory: %w", err)
+	}
+	return os.WriteFile(manifestPath, data, 0644)
+}
+
+// CacheControlFor returns the Cache-Control value of the first rule matching urlPath
+func CacheControlFor(rules []config.CacheRule, urlPath string) string {
+	for _, rule := range rules {
+		if MatchPattern(rule.Pattern, urlPath) {
+			return rule.CacheControl
+		}
+	}
+	return ""
+}
+
+// MatchPattern matches urlPath against a glob where "*" stays within one path
+// segment and a trailing "/**" matches everything below a prefix
+func MatchPattern(pattern, urlPath string) bool {
+	if pattern == "/**" {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		return urlPath == prefix || strings.HasPrefix(urlPath, prefix+"/")
+	}
+	matched, err := path.Match(pattern, urlPath)
+	return err == nil && matched
+}
+
+// Bypass disables caching for a response and ignores the client's validators,
+// used for admin-mode and dev requests that must always see fresh content
+func Bypass(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	r.Header.Del("If-None-Match")
+	r.Header.Del("If-Modified-Since")
+}
+
+// fileHash remembers the hash of a file until it changes on disk
+type fileHash struct {
+	modTime time.Time
+	size    int64
+	etag    string
+}
+
+// ETags resolves strong ETags for the compiled output (from the build
+// manifest) and for other files (hashed on first use)
+type ETags struct {
+	projectPath string
+	outputDir   string
+
+	mu          sync.Mutex
+	manifest    map[string]string
+	manifestMod time.Time
+	files       map[string]fileHash
+}
+
+func NewETags(projectPath, outputDir string) *ETags {
+	return &ETags{
+		projectPath: projectPath,
+		outputDir:   outputDir,
+		files:       make(map[string]fileHash),
+	}
+}
+
+// For returns the quoted ETag for the file at absPath
+func (e *ETags) For(absPath string) (string, error) {
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return "", err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if rel, err := filepath.Rel(e.outputDir, absPath); err == nil && !strings.HasPrefix(rel, "..") {
+		e.reloadManifestLocked()
+		if hash, ok := e.manifest[filepath.ToSlash(rel)]; ok {
+			return `"` + hash + `"`, nil
+		}
+	}
+
+	if cached, ok := e.files[absPath]; ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.etag, nil
+	}
+
+	content, err := os.ReadFile(absPath)
+	if err != nil {
+		return "", err
+	}
+	etag := `"` + Hash(content) + `"`
+	e.files[absPath] = fileHash{modTime: info.ModTime(), size: info.Size(), etag: etag}
+	return etag, nil
+}
+
+// reloadManifestLocked re-reads the manifest after a rebuild (must hold mu)
+func (e *ETags) reloadManifestLocked() {
+	info, err := os.Stat(ManifestPath(e.projectPath))
+	if err != nil {
+		e.manifest = nil
+		return
+	}
+	if e.manifest != nil && info.ModTime().Equal(e.manifestMod) {
+		return
+	}
+	data, err := os.ReadFile(ManifestPath(e.projectPath))
+	if err != nil {
+		return
+	}
+	var manifest map[string]string
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return
+	}
+	e.manifest = manifest
+	e.manifestMod = info.ModTime()
+}
+
+// ServeFile serves absPath with the Cache-Control of the first matching rule
+// and a strong ETag, preferring a precompressed variantBase.br/.gz when the
+// client accepts one. Conditional requests are answered with 304.
+func (e *ETags) ServeFile(w http.ResponseWriter, r *http.Request, rules []config.CacheRule, absPath, variantBase string) {
+	if cacheControl := CacheControlFor(rules, r.URL.Path); cacheControl != "" {
+		w.Header().Set("Cache-Control", cacheControl)
+	}
+	if etag, err := e.For(absPath); err == nil {
+		w.Header().Set("ETag", etag)
+	}
+	if compress.ServePrecompressed(w, r, absPath, variantBase) {
+		return
+	}
+	http.ServeFile(w, r, absPath)
+}
@@ -0,0 +1,3 @@
+package keys
+
+const TailwindEnabled = "TAILWIND_ENABLED"
@@ -0,0 +1,226 @@
+package livereload
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phillip-england/thispage/pkg/security"
+)
+
+// Path is the URL the dev script connects to for Server-Sent Events
+const Path = "/_thispage/livereload"
+
+// Event names sent to connected browsers
+const (
+	EventReload = "reload"
+	EventCSS    = "css"
+	EventError  = "build-error"
+)
+
+// heartbeatInterval keeps idle connections open through proxies
+const heartbeatInterval = 30 * time.Second
+
+// Event is a single message pushed to connected browsers
+type Event struct {
+	Name string
+	Data string
+}
+
+// Broker fans events out to every connected SSE client
+type Broker struct {
+	mu      sync.Mutex
+	clients map[chan Event]struct{}
+	// lastError is replayed to browsers that connect while the build is broken
+	lastError *Event
+	closed    bool
+}
+
+// Default is the broker shared by the watcher and the server
+var Default = NewBroker()
+
+func NewBroker() *Broker {
+	return &Broker{clients: make(map[chan Event]struct{})}
+}
+
+// Subscribe registers a new client and returns its event channel
+func (b *Broker) Subscribe() chan Event {
+	ch := make(chan Event, 8)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return ch
+	}
+	b.clients[ch] = struct{}{}
+	if b.lastError != nil {
+		ch <- *b.lastError
+	}
+	return ch
+}
+
+// Unsubscribe removes a client registered with Subscribe
+func (b *Broker) Unsubscribe(ch chan Event) {
+	b.mu.Lock()
+	delete(b.clients, ch)
+	b.mu.Unlock()
+}
+
+// Close disconnects every client so a server shutdown is not held open by
+// long-lived event streams
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for ch := range b.clients {
+		close(ch)
+		delete(b.clients, ch)
+	}
+}
+
+// Publish sends an event to every client without blocking on slow readers
+func (b *Broker) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch event.Name {
+	case EventError:
+		b.lastError = &event
+	case EventReload:
+		b.lastError = nil
+	}
+	for ch := range b.clients {
+		select {
+		case ch <- event:
+		default:
+			// Client is not keeping up, drop the event for it
+		}
+	}
+}
+
+// ServeHTTP streams events to the browser until it disconnects
+func (b *Broker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	events := b.Subscribe()
+	defer b.Unsubscribe(events)
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			writeEvent(w, event)
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event Event) {
+	fmt.Fprintf(w, "event: %s\n", event.Name)
+	for _, line := range strings.Split(event.Data, "\n") {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	fmt.Fprint(w, "\n")
+}
+
+// Publish sends an event through the Default broker
+func Publish(name, data string) {
+	Default.Publish(Event{Name: name, Data: data})
+}
+
+// Script is injected into pages served in dev mode. It reloads the page after
+// a rebuild, swaps stylesheets in place when only the Tailwind output changed,
+// and covers the page with an overlay while the last rebuild is failing.
+const Script = `
+` + security.NonceScriptTag + `
+  (function() {
+    if (!window.EventSource) return;
+    var source = new EventSource('` + Path + `');
+    var dropped = false;
+    source.addEventListener('` + EventReload + `', function() {
+      window.location.reload();
+    });
+    source.addEventListener('` + EventCSS + `', function() {
+      document.querySelectorAll('link[rel="stylesheet"]').forEach(function(link) {
+        var url = new URL(link.href, window.location.href);
+        if (url.origin !== window.location.origin || !url.pathname.endsWith('/output.css')) return;
+        url.searchParams.set('tp_v', Date.now());
+        link.href = url.toString();
+      });
+    });
+    source.addEventListener('` + EventError + `', function(e) {
+      var info;
+      try { info = JSON.parse(e.data); } catch (err) { info = { message: e.data }; }
+      var overlay = document.getElementById('__thispage_error_overlay');
+      if (!overlay) {
+        overlay = document.createElement('div');
+        overlay.id = '__thispage_error_overlay';
+        overlay.style.cssText = 'position:fixed;inset:0;z-index:2147483647;background:rgba(10,10,10,0.95);color:#fafafa;font-family:ui-monospace,SFMono-Regular,Menlo,monospace;padding:3rem;overflow:auto;';
+        document.body.appendChild(overlay);
+      }
+      overlay.textContent = '';
+      var title = document.createElement('div');
+      title.textContent = 'Build failed';
+      title.style.cssText = 'color:#f87171;font-size:0.75rem;letter-spacing:0.3em;text-transform:uppercase;font-weight:bold;margin-bottom:1.5rem;';
+      overlay.appendChild(title);
+      if (info.file) {
+        var location = document.createElement('div');
+        location.textContent = info.file + (info.line ? ':' + info.line : '');
+        location.style.cssText = 'color:#a3a3a3;font-size:0.875rem;margin-bottom:1rem;';
+        overlay.appendChild(location);
+      }
+      var message = document.createElement('pre');
+      message.textContent = info.message;
+      message.style.cssText = 'white-space:pre-wrap;font-size:1rem;line-height:1.5;border-left:3px solid #f87171;padding-left:1rem;';
+      overlay.appendChild(message);
+      var hint = document.createElement('div');
+      hint.textContent = 'Fix the error and save; this overlay clears on the next successful build.';
+      hint.style.cssText = 'color:#737373;font-size:0.75rem;margin-top:2rem;';
+      overlay.appendChild(hint);
+    });
+    source.onerror = function() { dropped = true; };
+    source.onopen = function() {
+      // The server restarted while we were disconnected
+      if (dropped) window.location.reload();
+    };
+  })();
+</script>`
+
+// Inject adds the live reload script before </body>, or appends it
+func Inject(html []byte) []byte {
+	marker := []byte("</body>")
+	if idx := bytes.LastIndex(html, marker); idx != -1 {
+		out := make([]byte, 0, len(html)+len(Script))
+		out = append(out, html[:idx]...)
+		out = append(out, Script...)
+		out = append(out, html[idx:]...)
+		return out
+	}
+	return append(html, Script...)
+}
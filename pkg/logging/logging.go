@@ -0,0 +1,267 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phillip-england/thispage/pkg/config"
+	"github.com/phillip-england/thispage/pkg/ratelimit"
+)
+
+// RequestIDHeader carries the request ID in both directions
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// Setup installs the project's logger as the slog default. The returned
+// closer flushes and closes the log file, if any.
+func Setup(projectPath string) (io.Closer, error) {
+	cfg, err := config.Load(projectPath)
+	if err != nil {
+		return nil, err
+	}
+	logCfg := cfg.Logging
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(logCfg.Level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", logCfg.Level, err)
+	}
+
+	var out io.Writer = os.Stderr
+	var closer io.Closer = nopCloser{}
+	if logCfg.File != "" {
+		path := logCfg.File
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(projectPath, path)
+		}
+		file, err := OpenRotatingFile(path, int64(logCfg.MaxSizeMB)<<20, logCfg.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		out, closer = file, file
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	if logCfg.Format == "json" {
+		handler = slog.NewJSONHandler(out, opts)
+	} else {
+		handler = slog.NewTextHandler(out, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+	return closer, nil
+}
+
+// Middleware assigns each request an ID (reusing a sane incoming one),
+// echoes it in the response and logs the request once it completes
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		level := slog.LevelInfo
+		if rec.status >= 500 {
+			level = slog.LevelError
+		}
+		slog.LogAttrs(r.Context(), level, "request",
+			slog.String("request_id", id),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Int64("bytes", rec.bytes),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", ratelimit.GetClientIP(r)),
+		)
+	})
+}
+
+// RequestID returns the ID Middleware assigned to r, or ""
+func RequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// FromRequest returns the default logger tagged with the request's ID
+func FromRequest(r *http.Request) *slog.Logger {
+	if id := RequestID(r); id != "" {
+		return slog.Default().With("request_id", id)
+	}
+	return slog.Default()
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// validRequestID keeps client-supplied IDs short and printable
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	return strings.IndexFunc(id, func(c rune) bool {
+		return !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.')
+	}) == -1
+}
+
+// responseRecorder remembers the status and size of a response
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(p []byte) (int, error) {
+	rec.wroteHeader = true
+	n, err := rec.ResponseWriter.Write(p)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Flush keeps streaming responses (live reload) working through the recorder
+func (rec *responseRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// RotatingFile is an append-only log file that is renamed to path.1, path.2,
+// ... once it exceeds maxSize, keeping at most maxBackups old files
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	closed bool
+}
+
+// OpenRotatingFile opens (or creates) the log file at path
+func OpenRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	rf := &RotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *RotatingFile) open() error {
+	file, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	rf.file, rf.size = file, info.Size()
+	return nil
+}
+
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.closed {
+		return 0, os.ErrClosed
+	}
+	if rf.file == nil {
+		// An earlier rotation could not reopen the file
+		if err := rf.open(); err != nil {
+			return 0, err
+		}
+	}
+	if rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		// A failed rotation still leaves path open, so keep logging to it
+		// and try again on the next write
+		if err := rf.rotate(); err != nil && rf.file == nil {
+			return 0, err
+		}
+	}
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// rotate shifts path.N-1 to path.N and so on, dropping the oldest, then
+// reopens path, even when it could not be moved (must hold mu)
+func (rf *RotatingFile) rotate() error {
+	rf.file.Close()
+	rf.file = nil
+	err := rf.shift()
+	if openErr := rf.open(); openErr != nil {
+		return openErr
+	}
+	return err
+}
+
+func (rf *RotatingFile) shift() error {
+	if rf.maxBackups == 0 {
+		if err := os.Remove(rf.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	os.Remove(fmt.Sprintf("%s.%d", rf.path, rf.maxBackups))
+	for i := rf.maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", rf.path, i), fmt.Sprintf("%s.%d", rf.path, i+1))
+	}
+	return os.Rename(rf.path, rf.path+".1")
+}
+
+// Close closes the current log file
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	rf.closed = true
+	if rf.file == nil {
+		return nil
+	}
+	err := rf.file.Close()
+	rf.file = nil
+	return err
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
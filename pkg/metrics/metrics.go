@@ -0,0 +1,295 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Path is where the Prometheus exposition is served
+const Path = "/metrics"
+
+// DefaultBuckets are the latency buckets, in seconds, used by every histogram
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Counter is a monotonically increasing value split by label values
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// Histogram counts observations into cumulative buckets split by label values
+type Histogram struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// gauge is sampled when /metrics is scraped
+type gauge struct {
+	name  string
+	help  string
+	value func() (float64, error)
+}
+
+var (
+	registryMu sync.Mutex
+	counters   []*Counter
+	histograms []*Histogram
+	gauges     []gauge
+)
+
+// The metrics thispage records
+var (
+	HTTPRequests = NewCounter("thispage_http_requests_total",
+		"HTTP requests by method, route pattern and status code.", "method", "route", "code")
+	HTTPDuration = NewHistogram("thispage_http_request_duration_seconds",
+		"HTTP request latency by method and route pattern.", "method", "route")
+	Builds = NewCounter("thispage_builds_total",
+		"Site builds by result (success or failure).", "result")
+	BuildDuration = NewHistogram("thispage_build_duration_seconds",
+		"Time spent compiling the site.")
+	LoginFailures = NewCounter("thispage_login_failures_total",
+		"Failed admin login attempts.")
+	RateLimited = NewCounter("thispage_rate_limited_total",
+		"Requests refused with 429 by rate limit policy.", "policy")
+)
+
+// NewCounter creates and registers a counter
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{name: name, help: help, labels: labels, values: make(map[string]float64)}
+	registryMu.Lock()
+	counters = append(counters, c)
+	registryMu.Unlock()
+	return c
+}
+
+// NewHistogram creates and registers a histogram with DefaultBuckets
+func NewHistogram(name, help string, labels ...string) *Histogram {
+	h := &Histogram{name: name, help: help, labels: labels, buckets: DefaultBuckets, series: make(map[string]*histogramSeries)}
+	registryMu.Lock()
+	histograms = append(histograms, h)
+	registryMu.Unlock()
+	return h
+}
+
+// RegisterGauge adds a gauge whose value is read at scrape time
+func RegisterGauge(name, help string, value func() (float64, error)) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for i, g := range gauges {
+		if g.name == name {
+			gauges[i].value = value
+			return
+		}
+	}
+	gauges = append(gauges, gauge{name: name, help: help, value: value})
+}
+
+// Inc adds one to the series with these label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.mu.Lock()
+	c.values[labelKey(c.labels, labelValues)]++
+	c.mu.Unlock()
+}
+
+// Observe records one value in the series with these label values
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key := labelKey(h.labels, labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	series, ok := h.series[key]
+	if !ok {
+		series = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = series
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			series.counts[i]++
+		}
+	}
+	series.sum += value
+	series.count++
+}
+
+// ObserveSince records the time elapsed since start
+func (h *Histogram) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// Middleware counts requests and their latency per route pattern. mux resolves
+// the pattern so that label values stay bounded no matter what URLs are hit.
+func Middleware(mux *http.ServeMux) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			_, route := mux.Handler(r)
+			if route == "" {
+				route = "unmatched"
+			}
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+			HTTPRequests.Inc(r.Method, route, strconv.Itoa(rec.status))
+			HTTPDuration.ObserveSince(start, r.Method, route)
+		})
+	}
+}
+
+// statusRecorder remembers the status code a handler wrote
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(p []byte) (int, error) {
+	rec.wroteHeader = true
+	return rec.ResponseWriter.Write(p)
+}
+
+// Flush keeps streaming responses (live reload) working through the recorder
+func (rec *statusRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// Handler writes every registered metric in the Prometheus text format
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+
+	registryMu.Lock()
+	cs := append([]*Counter(nil), counters...)
+	hs := append([]*Histogram(nil), histograms...)
+	gs := append([]gauge(nil), gauges...)
+	registryMu.Unlock()
+
+	var b strings.Builder
+	for _, c := range cs {
+		c.write(&b)
+	}
+	for _, h := range hs {
+		h.write(&b)
+	}
+	for _, g := range gs {
+		value, err := g.value()
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.name, g.help, g.name, g.name, formatFloat(value))
+	}
+	w.Write([]byte(b.String()))
+}
+
+func (c *Counter) write(b *strings.Builder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	if len(c.labels) == 0 && len(c.values) == 0 {
+		fmt.Fprintf(b, "%s 0\n", c.name)
+		return
+	}
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(b, "%s%s %s\n", c.name, braces(key), formatFloat(c.values[key]))
+	}
+}
+
+func (h *Histogram) write(b *strings.Builder) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		series := h.series[key]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(b, "%s_bucket%s %d\n", h.name, braces(joinLabels(key, `le="`+formatFloat(bound)+`"`)), series.counts[i])
+		}
+		fmt.Fprintf(b, "%s_bucket%s %d\n", h.name, braces(joinLabels(key, `le="+Inf"`)), series.count)
+		fmt.Fprintf(b, "%s_sum%s %s\n", h.name, braces(key), formatFloat(series.sum))
+		fmt.Fprintf(b, "%s_count%s %d\n", h.name, braces(key), series.count)
+	}
+}
+
+// labelKey renders label pairs as they appear inside braces
+func labelKey(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs[i] = name + `="` + escapeLabel(value) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func joinLabels(key, extra string) string {
+	if key == "" {
+		return extra
+	}
+	return key + "," + extra
+}
+
+func braces(key string) string {
+	if key == "" {
+		return ""
+	}
+	return "{" + key + "}"
+}
+
+func sortedKeys(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
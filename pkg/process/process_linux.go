@@ -0,0 +1,11 @@
+//go:build linux
+
+package process
+
+import "syscall"
+
+// ChildAttr makes the kernel terminate a child process if thispage dies
+// without running its shutdown path (e.g. SIGKILL)
+func ChildAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Pdeathsig: syscall.SIGTERM}
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !windows
+
+package process
+
+import "syscall"
+
+// ChildAttr returns no special attributes on this platform
+func ChildAttr() *syscall.SysProcAttr {
+	return nil
+}
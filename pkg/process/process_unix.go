@@ -0,0 +1,13 @@
+//go:build !windows
+
+package process
+
+import (
+	"os"
+	"syscall"
+)
+
+// Interrupt asks the process to exit cleanly
+func Interrupt(p *os.Process) error {
+	return p.Signal(syscall.SIGTERM)
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package process
+
+import (
+	"os"
+	"syscall"
+)
+
+// Interrupt kills the process; Windows has no SIGTERM equivalent
+func Interrupt(p *os.Process) error {
+	return p.Kill()
+}
+
+// ChildAttr returns no special attributes on this platform
+func ChildAttr() *syscall.SysProcAttr {
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/phillip-england/thispage/pkg/config"
 	"github.com/phillip-england/thispage/pkg/credentials"
 )
 
@@ -32,8 +33,10 @@ func New(name string, force bool, username, password string) error {
 		return fmt.Errorf("could not create project directory '%s': %w", name, err)
 	}
 
+	outputDir := config.Default().Build.OutputDir
+
 	// Define subdirectory paths
-	dirs := []string{"live", "components", "templates", "static", "layouts", ".thispage"}
+	dirs := []string{outputDir, "components", "templates", "static", "layouts", ".thispage"}
 
 	for _, dir := range dirs {
 		dirPath := filepath.Join(name, dir)
@@ -100,7 +103,146 @@ func New(name string, force bool, username, password string) error {
 data.db
 
 # Build output
-live/
+` + outputDir + `/
+`
+
+	configContent := `# thispage project configuration
+# Every setting can also be overridden with a THISPAGE_* environment variable.
+
+[server]
+port = "8080"
+# Listen on one interface only, e.g. "127.0.0.1"; empty listens on all
+bind_address = ""
+# Serve /admin and /login on a separate "host:port", e.g. "127.0.0.1:9090",
+# so the public port only serves the site; empty keeps them on the public port
+admin_address = ""
+shutdown_timeout_seconds = 10
+# Reverse proxies allowed to report the client IP (X-Forwarded-For / Forwarded),
+# e.g. ["127.0.0.1", "10.0.0.0/8"]
+trusted_proxies = []
+
+[build]
+output_dir = "` + outputDir + `"
+
+[auth]
+session_minutes = 15
+# Sessions end this many hours after sign-in even while in use
+absolute_session_hours = 24
+# SameSite mode of the admin session cookie: "lax" or "strict"
+same_site = "lax"
+
+[database]
+max_login_attempts = 1000
+max_blacklist_entries = 1000
+max_admin_messages = 100
+max_messages_per_ip_per_day = 3
+failed_attempt_threshold = 5
+attempt_window_seconds = 60
+# IPs with too many failed logins are banned for ban_minutes, doubling with
+# each repeat ban up to max_ban_hours
+ban_minutes = 15
+max_ban_hours = 24
+# IPs that are never banned, e.g. ["203.0.113.7", "10.0.0.0/8"]
+ban_allowlist = []
+
+[uploads]
+max_file_size_mb = 10
+max_zip_size_mb = 50
+
+# Cookie-less page view counts, viewable at /admin/analytics. No IPs are stored.
+[analytics]
+enabled = true
+retention_days = 90
+
+# Prometheus metrics at /metrics. Only allowed_ips may scrape, or any client
+# sending "Authorization: Bearer <token>" when token is set.
+[metrics]
+enabled = false
+allowed_ips = ["127.0.0.1", "::1"]
+token = ""
+
+# Token buckets per client IP. The first policy matching a request applies;
+# requests matching none are not limited. Over the limit gets a 429 with
+# Retry-After. persist keeps the buckets in data.db across restarts.
+# Behind a reverse proxy, set server.trusted_proxies before enabling this, or
+# every visitor shares the proxy's bucket.
+[rate_limit]
+enabled = false
+persist = false
+
+[[rate_limit.policies]]
+name = "contact"
+pattern = "/contact"
+methods = ["POST"]
+requests_per_minute = 6
+burst = 3
+
+[[rate_limit.policies]]
+name = "login"
+pattern = "/login/**"
+methods = ["POST"]
+requests_per_minute = 20
+burst = 10
+
+[[rate_limit.policies]]
+name = "admin"
+pattern = "/admin/**"
+requests_per_minute = 600
+burst = 200
+
+[[rate_limit.policies]]
+name = "static"
+pattern = "/static/**"
+requests_per_minute = 600
+burst = 200
+
+[[rate_limit.policies]]
+name = "pages"
+pattern = "/**"
+requests_per_minute = 120
+burst = 60
+
+[logging]
+level = "info"
+# "text" or "json"
+format = "text"
+# Log file relative to the project, rotated by size; empty logs to stderr
+file = ""
+max_size_mb = 10
+max_backups = 5
+
+[security]
+# Strict-Transport-Security is only sent over HTTPS; 0 disables it
+hsts_max_age_seconds = 31536000
+referrer_policy = "strict-origin-when-cross-origin"
+frame_ancestors = "'self'"
+# Applied to your pages; a nonce for the admin-mode script is added automatically.
+# Example: "default-src 'self'; script-src 'self' https://cdn.tailwindcss.com"
+content_security_policy = ""
+
+# HTTPS: set cert_file/key_file, or list domains under [tls.acme] to get
+# certificates automatically. Session cookies become Secure when TLS is on.
+[tls]
+cert_file = ""
+key_file = ""
+# Plain HTTP port that redirects to HTTPS, e.g. "80"
+redirect_port = ""
+
+[tls.acme]
+domains = []
+email = ""
+directory_url = "https://acme-v02.api.letsencrypt.org/directory"
+cache_dir = ".thispage/certs"
+ca_file = ""
+
+# Cache-Control per URL path, first match wins. Admin-mode requests are never cached.
+[[cache.rules]]
+pattern = "/static/**"
+cache_control = "public, max-age=3600"
+
+[[cache.rules]]
+pattern = "/**"
+cache_control = "no-cache"
 `
 
 	filesToCreate := map[string]string{
@@ -110,6 +252,7 @@ live/
 		filepath.Join(componentsDirPath, "footer.html"):     defaultFooterHTML,
 		filepath.Join(name, "static/input.css"):             "@import \"tailwindcss\";\n",
 		filepath.Join(name, ".gitignore"):                   gitignoreContent,
+		filepath.Join(name, "thispage.toml"):                configContent,
 	}
 
 	for path, content := range filesToCreate {
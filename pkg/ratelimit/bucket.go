@@ -0,0 +1,206 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/phillip-england/thispage/pkg/config"
+	"github.com/phillip-england/thispage/pkg/database"
+	"github.com/phillip-england/thispage/pkg/httpcache"
+	"github.com/phillip-england/thispage/pkg/metrics"
+)
+
+// exemptPaths are never limited, so load balancers and monitoring keep
+// working however busy the site is
+var exemptPaths = []string{"/healthz", "/readyz", metrics.Path}
+
+// sweepInterval is how often full buckets are dropped; a client that comes
+// back simply gets a new full one
+const sweepInterval = time.Minute
+
+// Limiter keeps a token bucket per rate limit policy and client IP. Every
+// request takes a token, and tokens come back at the policy's rate up to its
+// burst.
+type Limiter struct {
+	mu        sync.Mutex
+	buckets   map[bucketKey]*bucket
+	lastSweep time.Time
+}
+
+type bucketKey struct {
+	policy string
+	client string
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewLimiter returns a Limiter where every client starts with a full bucket
+func NewLimiter() *Limiter {
+	return &Limiter{buckets: make(map[bucketKey]*bucket)}
+}
+
+// Allow takes a token from client's bucket for policy. When the bucket is
+// empty it returns false and how long until the next token.
+func (l *Limiter) Allow(policy config.RateLimitPolicy, client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	key := bucketKey{policy.Name, client}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(policy.Burst), updated: now}
+		l.buckets[key] = b
+	}
+	refill(b, policy, now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := (1 - b.tokens) / perSecond(policy)
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// sweep drops the buckets that have refilled completely. Callers hold l.mu.
+func (l *Limiter) sweep(now time.Time) {
+	policies := policiesByName()
+	for key, b := range l.buckets {
+		policy, ok := policies[key.policy]
+		if !ok {
+			delete(l.buckets, key)
+			continue
+		}
+		refill(b, policy, now)
+		if b.tokens >= float64(policy.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+func refill(b *bucket, policy config.RateLimitPolicy, now time.Time) {
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(policy.Burst), b.tokens+elapsed*perSecond(policy))
+		b.updated = now
+	}
+}
+
+func perSecond(policy config.RateLimitPolicy) float64 {
+	return float64(policy.RequestsPerMinute) / 60
+}
+
+func policiesByName() map[string]config.RateLimitPolicy {
+	policies := map[string]config.RateLimitPolicy{}
+	for _, policy := range config.Get().RateLimit.Policies {
+		policies[policy.Name] = policy
+	}
+	return policies
+}
+
+// MatchPolicy returns the first policy matching r's method and path
+func MatchPolicy(policies []config.RateLimitPolicy, r *http.Request) (config.RateLimitPolicy, bool) {
+	for _, policy := range policies {
+		if len(policy.Methods) > 0 && !slices.Contains(policy.Methods, r.Method) {
+			continue
+		}
+		if httpcache.MatchPattern(policy.Pattern, r.URL.Path) {
+			return policy, true
+		}
+	}
+	return config.RateLimitPolicy{}, false
+}
+
+// Middleware answers 429 Too Many Requests, with Retry-After, once a client
+// has used up its bucket for the policy matching the request. IPs on
+// database.ban_allowlist and the probe and metrics paths are never limited.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := config.Get().RateLimit
+		if !cfg.Enabled || slices.Contains(exemptPaths, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		policy, ok := MatchPolicy(cfg.Policies, r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		client := GetClientIP(r)
+		if IsAllowlisted(client) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed, wait := l.Allow(policy, client, time.Now())
+		if !allowed {
+			metrics.RateLimited.Inc(policy.Name)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "Too many requests, try again later", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Load restores the buckets saved by Save and clears them from the database
+func (l *Limiter) Load() error {
+	rows, err := database.DB.Query("SELECT policy, client, tokens, updated_at FROM RATE_LIMIT_BUCKET")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for rows.Next() {
+		var key bucketKey
+		var b bucket
+		if err := rows.Scan(&key.policy, &key.client, &b.tokens, &b.updated); err != nil {
+			return err
+		}
+		l.buckets[key] = &b
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = database.DB.Exec("DELETE FROM RATE_LIMIT_BUCKET")
+	return err
+}
+
+// Save writes the buckets that are not full to the database for Load
+func (l *Limiter) Save() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(time.Now())
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM RATE_LIMIT_BUCKET"); err != nil {
+		return err
+	}
+	for key, b := range l.buckets {
+		_, err := tx.Exec(`
+			INSERT INTO RATE_LIMIT_BUCKET (policy, client, tokens, updated_at)
+			VALUES (?, ?, ?, ?)
+		`, key.policy, key.client, b.tokens, b.updated.UTC().Round(0))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
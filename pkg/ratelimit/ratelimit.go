@@ -1,66 +1,187 @@
 package ratelimit
 
 import (
+	"database/sql"
 	"net"
 	"net/http"
+	"net/netip"
 	"strings"
 	"time"
 
+	"github.com/phillip-england/thispage/pkg/config"
 	"github.com/phillip-england/thispage/pkg/database"
+	"github.com/phillip-england/thispage/pkg/metrics"
 )
 
 // LoginStatus represents the current rate limit status for an IP
 type LoginStatus struct {
-	IsBlacklisted  bool
+	IsBlacklisted bool
+	// BannedUntil is when the ban ends, set when IsBlacklisted
+	BannedUntil    time.Time
 	FailedAttempts int
 	AttemptsLeft   int
 }
 
-// GetClientIP extracts the client IP address from the request
+// Ban is an IP's entry on the login blacklist. Entries outlive their ban so
+// the next ban of the same IP can be longer.
+type Ban struct {
+	IPAddress string
+	BannedAt  time.Time
+	ExpiresAt time.Time
+	// Count is how many bans in a row the IP has had
+	Count int
+}
+
+// Active reports whether the ban is still in force
+func (b Ban) Active() bool {
+	return time.Now().Before(b.ExpiresAt)
+}
+
+// GetClientIP extracts the client IP address from the request. Forwarding
+// headers are only believed when the connection comes from a trusted proxy
+// (server.trusted_proxies), and the chain is walked right-to-left so a client
+// cannot prepend a spoofed address.
 func GetClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header first (for proxies)
-	xff := r.Header.Get("X-Forwarded-For")
-	if xff != "" {
-		// Take the first IP in the list
-		parts := strings.Split(xff, ",")
-		if len(parts) > 0 {
-			ip := strings.TrimSpace(parts[0])
-			if ip != "" {
-				return ip
+	remote, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		ip, _, splitErr := net.SplitHostPort(r.RemoteAddr)
+		if splitErr != nil {
+			return r.RemoteAddr
+		}
+		return ip
+	}
+
+	trusted := config.Get().Server.TrustedProxyPrefixes()
+	client := remote.Addr().Unmap()
+	if !isTrusted(client, trusted) {
+		return client.String()
+	}
+
+	// Forwarded (RFC 7239) takes precedence over the de facto headers
+	hops := forwardedHops(r.Header.Values("Forwarded"))
+	if len(hops) == 0 {
+		hops = xffHops(r.Header.Values("X-Forwarded-For"))
+	}
+	if len(hops) == 0 {
+		if xri, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+			return xri.Unmap().String()
+		}
+		return client.String()
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := parseHop(hops[i])
+		if err != nil {
+			// Garbage or an obfuscated identifier; the last trusted hop is all we know
+			return client.String()
+		}
+		client = hop
+		if !isTrusted(client, trusted) {
+			return client.String()
+		}
+	}
+	return client.String()
+}
+
+// FromTrustedProxy reports whether the request arrived directly from one of
+// server.trusted_proxies
+func FromTrustedProxy(r *http.Request) bool {
+	remote, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	return isTrusted(remote.Addr().Unmap(), config.Get().Server.TrustedProxyPrefixes())
+}
+
+func isTrusted(addr netip.Addr, trusted []netip.Prefix) bool {
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// xffHops splits X-Forwarded-For values, which may be repeated headers
+func xffHops(values []string) []string {
+	var hops []string
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			hops = append(hops, strings.TrimSpace(part))
+		}
+	}
+	return hops
+}
+
+// forwardedHops extracts the for= node of each Forwarded element
+func forwardedHops(values []string) []string {
+	var hops []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			node := ""
+			for _, pair := range strings.Split(element, ";") {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					node = val
+				}
 			}
+			hops = append(hops, node)
 		}
 	}
+	return hops
+}
 
-	// Check X-Real-IP header
-	xri := r.Header.Get("X-Real-IP")
-	if xri != "" {
-		return xri
+// parseHop accepts "ip", "ip:port", "[ipv6]:port" and quoted forms
+func parseHop(hop string) (netip.Addr, error) {
+	hop = strings.Trim(strings.TrimSpace(hop), `"`)
+	if addrPort, err := netip.ParseAddrPort(hop); err == nil {
+		return addrPort.Addr().Unmap(), nil
 	}
+	addr, err := netip.ParseAddr(strings.Trim(hop, "[]"))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return addr.Unmap(), nil
+}
 
-	// Fall back to RemoteAddr
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+// IsAllowlisted reports whether ip is on database.ban_allowlist and so is
+// never banned
+func IsAllowlisted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
 	if err != nil {
-		return r.RemoteAddr
+		return false
 	}
-	return ip
+	return isTrusted(addr.Unmap(), config.Get().Database.BanAllowlistPrefixes())
 }
 
-// IsBlacklisted checks if an IP address is in the blacklist
+// IsBlacklisted checks if an IP address is currently banned
 func IsBlacklisted(ip string) (bool, error) {
-	var count int
+	_, banned, err := bannedUntil(ip)
+	return banned, err
+}
+
+// bannedUntil returns when ip's ban ends, if it is banned
+func bannedUntil(ip string) (time.Time, bool, error) {
+	if IsAllowlisted(ip) {
+		return time.Time{}, false, nil
+	}
+	var expiresAt time.Time
 	err := database.DB.QueryRow(
-		"SELECT COUNT(*) FROM LOGIN_BLACKLIST WHERE ip_address = ?",
-		ip,
-	).Scan(&count)
+		"SELECT expires_at FROM LOGIN_BLACKLIST WHERE ip_address = ? AND expires_at > ?",
+		ip, time.Now(),
+	).Scan(&expiresAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, false, nil
+	}
 	if err != nil {
-		return false, err
+		return time.Time{}, false, err
 	}
-	return count > 0, nil
+	return expiresAt, true, nil
 }
 
 // GetRecentFailedAttempts returns the count of failed attempts within the time window
 func GetRecentFailedAttempts(ip string) (int, error) {
-	windowStart := time.Now().Add(-time.Duration(database.AttemptWindowSeconds) * time.Second)
+	windowStart := time.Now().Add(-time.Duration(config.Get().Database.AttemptWindowSeconds) * time.Second)
 	var count int
 	err := database.DB.QueryRow(`
 		SELECT COUNT(*) FROM LOGIN_ATTEMPT
@@ -77,11 +198,12 @@ func GetLoginStatus(ip string) (LoginStatus, error) {
 	status := LoginStatus{}
 
 	// Check blacklist
-	blacklisted, err := IsBlacklisted(ip)
+	until, blacklisted, err := bannedUntil(ip)
 	if err != nil {
 		return status, err
 	}
 	status.IsBlacklisted = blacklisted
+	status.BannedUntil = until
 
 	if blacklisted {
 		status.AttemptsLeft = 0
@@ -94,7 +216,12 @@ func GetLoginStatus(ip string) (LoginStatus, error) {
 		return status, err
 	}
 	status.FailedAttempts = failedCount
-	status.AttemptsLeft = database.FailedAttemptThreshold - failedCount
+	status.AttemptsLeft = config.Get().Database.FailedAttemptThreshold - failedCount
+	if IsAllowlisted(ip) {
+		// Allowlisted IPs are never locked out, so there is nothing to warn about
+		status.FailedAttempts = 0
+		status.AttemptsLeft = config.Get().Database.FailedAttemptThreshold
+	}
 
 	if status.AttemptsLeft < 0 {
 		status.AttemptsLeft = 0
@@ -111,7 +238,7 @@ func evictOldestAttempt() error {
 		return err
 	}
 
-	if count >= database.MaxLoginAttempts {
+	if count >= config.Get().Database.MaxLoginAttempts {
 		_, err = database.DB.Exec(`
 			DELETE FROM LOGIN_ATTEMPT
 			WHERE id = (SELECT id FROM LOGIN_ATTEMPT ORDER BY attempted_at ASC LIMIT 1)
@@ -123,7 +250,8 @@ func evictOldestAttempt() error {
 	return nil
 }
 
-// evictOldestBlacklist removes the oldest entry from LOGIN_BLACKLIST if at capacity
+// evictOldestBlacklist removes the entry that expires first from
+// LOGIN_BLACKLIST if at capacity, so expired bans go before active ones
 func evictOldestBlacklist() error {
 	var count int
 	err := database.DB.QueryRow("SELECT COUNT(*) FROM LOGIN_BLACKLIST").Scan(&count)
@@ -131,10 +259,10 @@ func evictOldestBlacklist() error {
 		return err
 	}
 
-	if count >= database.MaxBlacklistEntries {
+	if count >= config.Get().Database.MaxBlacklistEntries {
 		_, err = database.DB.Exec(`
 			DELETE FROM LOGIN_BLACKLIST
-			WHERE id = (SELECT id FROM LOGIN_BLACKLIST ORDER BY blacklisted_at ASC LIMIT 1)
+			WHERE id = (SELECT id FROM LOGIN_BLACKLIST ORDER BY expires_at ASC LIMIT 1)
 		`)
 		if err != nil {
 			return err
@@ -176,6 +304,7 @@ func RecordAttempt(ip string, success bool) (shouldBlacklist bool, err error) {
 	if success {
 		return false, nil
 	}
+	metrics.LoginFailures.Inc()
 
 	// Check if we should blacklist this IP
 	failedCount, err := GetRecentFailedAttempts(ip)
@@ -183,22 +312,105 @@ func RecordAttempt(ip string, success bool) (shouldBlacklist bool, err error) {
 		return false, err
 	}
 
-	return failedCount >= database.FailedAttemptThreshold, nil
+	return failedCount >= config.Get().Database.FailedAttemptThreshold && !IsAllowlisted(ip), nil
 }
 
-// AddToBlacklist adds an IP to the blacklist
-func AddToBlacklist(ip string) error {
-	// Evict oldest if at capacity
-	if err := evictOldestBlacklist(); err != nil {
-		return err
+// BlacklistSize returns the number of currently banned IPs
+func BlacklistSize() (int, error) {
+	var count int
+	err := database.DB.QueryRow("SELECT COUNT(*) FROM LOGIN_BLACKLIST WHERE expires_at > ?", time.Now()).Scan(&count)
+	return count, err
+}
+
+// AddToBlacklist bans an IP and returns when the ban ends. The first ban
+// lasts database.ban_minutes and every repeat ban twice as long as the one
+// before, up to database.max_ban_hours. An IP that stayed out of trouble for
+// max_ban_hours after its last ban starts over.
+func AddToBlacklist(ip string) (time.Time, error) {
+	if IsAllowlisted(ip) {
+		return time.Time{}, nil
 	}
 
-	// Add to blacklist (ignore if already exists due to UNIQUE constraint)
-	_, err := database.DB.Exec(`
-		INSERT OR IGNORE INTO LOGIN_BLACKLIST (ip_address, blacklisted_at)
-		VALUES (?, ?)
-	`, ip, time.Now())
-	return err
+	now := time.Now()
+	count := 1
+	var previous int
+	var expiresAt time.Time
+	err := database.DB.QueryRow("SELECT ban_count, expires_at FROM LOGIN_BLACKLIST WHERE ip_address = ?", ip).Scan(&previous, &expiresAt)
+	switch {
+	case err == sql.ErrNoRows:
+		// Evict oldest if at capacity
+		if err := evictOldestBlacklist(); err != nil {
+			return time.Time{}, err
+		}
+	case err != nil:
+		return time.Time{}, err
+	case now.Before(expiresAt):
+		// Already banned
+		return expiresAt, nil
+	case now.Sub(expiresAt) < maxBan():
+		count = previous + 1
+	}
+
+	expiresAt = now.Add(banDuration(count))
+	_, err = database.DB.Exec(`
+		INSERT INTO LOGIN_BLACKLIST (ip_address, blacklisted_at, expires_at, ban_count)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(ip_address) DO UPDATE SET
+			blacklisted_at = excluded.blacklisted_at,
+			expires_at = excluded.expires_at,
+			ban_count = excluded.ban_count
+	`, ip, now, expiresAt, count)
+	return expiresAt, err
+}
+
+// banDuration is how long the count-th ban in a row lasts
+func banDuration(count int) time.Duration {
+	d := time.Duration(config.Get().Database.BanMinutes) * time.Minute
+	for i := 1; i < count && d < maxBan(); i++ {
+		d *= 2
+	}
+	return min(d, maxBan())
+}
+
+func maxBan() time.Duration {
+	return time.Duration(config.Get().Database.MaxBanHours) * time.Hour
+}
+
+// ListBans returns every blacklist entry, most recently banned first
+func ListBans() ([]Ban, error) {
+	rows, err := database.DB.Query(`
+		SELECT ip_address, blacklisted_at, expires_at, ban_count
+		FROM LOGIN_BLACKLIST
+		ORDER BY blacklisted_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bans []Ban
+	for rows.Next() {
+		var b Ban
+		if err := rows.Scan(&b.IPAddress, &b.BannedAt, &b.ExpiresAt, &b.Count); err != nil {
+			return nil, err
+		}
+		bans = append(bans, b)
+	}
+	return bans, rows.Err()
+}
+
+// Unban lifts ip's ban, forgets its earlier bans and clears its failed
+// attempts. It reports whether ip was on the blacklist.
+func Unban(ip string) (bool, error) {
+	result, err := database.DB.Exec("DELETE FROM LOGIN_BLACKLIST WHERE ip_address = ?", ip)
+	if err != nil {
+		return false, err
+	}
+	if err := ClearAttemptsForIP(ip); err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
 }
 
 // ClearAttemptsForIP clears all login attempts for an IP (call on successful login)
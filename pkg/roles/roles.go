@@ -0,0 +1,93 @@
+package roles
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Roles an admin user can have
+const (
+	// Owner can do everything, including deploying and exporting the project
+	Owner = "owner"
+	// Editor can only work on templates and components
+	Editor = "editor"
+	// Viewer can only read contact messages and analytics
+	Viewer = "viewer"
+)
+
+// All lists every role, most privileged first
+var All = []string{Owner, Editor, Viewer}
+
+// Permission is something a role may be allowed to do
+type Permission int
+
+const (
+	// ManageProject covers zip deploys, exports and every file directory
+	ManageProject Permission = iota
+	// EditContent covers the file manager and in-page editing
+	EditContent
+	// ReadMessages covers reading contact form messages
+	ReadMessages
+	// DeleteMessages covers deleting contact form messages
+	DeleteMessages
+	// ViewAnalytics covers the analytics page
+	ViewAnalytics
+	// ViewAudit covers reading and exporting the audit log
+	ViewAudit
+)
+
+var permissions = map[string][]Permission{
+	Owner:  {ManageProject, EditContent, ReadMessages, DeleteMessages, ViewAnalytics, ViewAudit},
+	Editor: {EditContent},
+	Viewer: {ReadMessages, ViewAnalytics},
+}
+
+// editorDirs are the top-level directories an editor may touch
+var editorDirs = []string{"templates", "components"}
+
+// Valid reports whether role is a known role
+func Valid(role string) bool {
+	_, ok := permissions[role]
+	return ok
+}
+
+// Can reports whether role has the permission
+func Can(role string, permission Permission) bool {
+	for _, p := range permissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// CanEditPath reports whether role may change the file or directory at
+// relPath (relative to the project). It only answers the role question; the
+// routes still validate the path itself.
+func CanEditPath(role, relPath string) bool {
+	if Can(role, ManageProject) {
+		return true
+	}
+	if !Can(role, EditContent) {
+		return false
+	}
+	top, _, _ := strings.Cut(filepath.ToSlash(filepath.Clean(relPath)), "/")
+	for _, dir := range editorDirs {
+		if top == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// EditableDirs filters the file manager's top-level directories down to the
+// ones role may change
+func EditableDirs(role string, dirs []string) []string {
+	var allowed []string
+	for _, dir := range dirs {
+		if CanEditPath(role, dir) {
+			allowed = append(allowed, dir)
+		}
+	}
+	return allowed
+}
@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/phillip-england/thispage/pkg/keys"
+	"github.com/phillip-england/vii/vii"
+)
+
+// DeleteAPIFile deletes the file or directory named by the path query
+// parameter
+func DeleteAPIFile(w http.ResponseWriter, r *http.Request) {
+	projectPath, ok := vii.GetContext(keys.ProjectPath, r).(string)
+	if !ok {
+		vii.WriteError(w, http.StatusInternalServerError, "Project path not found in context")
+		return
+	}
+
+	if ferr := deleteFile(r, projectPath, r.URL.Query().Get("path")); ferr != nil {
+		vii.WriteError(w, ferr.status, ferr.message)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
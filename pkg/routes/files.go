@@ -0,0 +1,191 @@
+package routes
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/phillip-england/thispage/pkg/audit"
+)
+
+// fileError is a failed file operation and the status to answer it with.
+// The admin forms and the JSON API share these checks, so both refuse the
+// same paths for the same reasons.
+type fileError struct {
+	status  int
+	message string
+}
+
+func (e *fileError) Error() string {
+	return e.message
+}
+
+// rootDirs may not be renamed or deleted
+var rootDirs = []string{"templates", "components", "static", "layouts"}
+
+func isRootDir(slashPath string) bool {
+	for _, dir := range rootDirs {
+		if slashPath == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// isTextFile reports whether relPath is a file the editor can change as text
+func isTextFile(relPath string) bool {
+	slashPath := filepath.ToSlash(relPath)
+	if strings.HasPrefix(slashPath, "static/") {
+		switch strings.ToLower(filepath.Ext(slashPath)) {
+		case ".css", ".js":
+			return true
+		}
+		return false
+	}
+	return isPathAllowed(relPath, false)
+}
+
+// projectFile cleans relPath and checks that it stays inside projectPath and
+// that the signed-in user's role may change it. It returns the cleaned
+// relative path and the absolute one.
+func projectFile(r *http.Request, projectPath, relPath string) (string, string, *fileError) {
+	if relPath == "" {
+		return "", "", &fileError{http.StatusBadRequest, "Path is required"}
+	}
+	relPath = filepath.Clean(relPath)
+
+	// Editors are limited to some directories
+	if !canEditPath(r, relPath) {
+		return "", "", &fileError{http.StatusForbidden, "Access denied: Your role cannot change this directory."}
+	}
+
+	absPath := filepath.Join(projectPath, relPath)
+	if !strings.HasPrefix(absPath, projectPath) {
+		return "", "", &fileError{http.StatusForbidden, "Access denied: Path outside project directory"}
+	}
+	return relPath, absPath, nil
+}
+
+// readFile returns the content of a text file
+func readFile(r *http.Request, projectPath, relPath string) (string, *fileError) {
+	_, absPath, ferr := projectFile(r, projectPath, relPath)
+	if ferr != nil {
+		return "", ferr
+	}
+	if !isTextFile(relPath) {
+		return "", &fileError{http.StatusForbidden, "Access denied: Restricted file or directory."}
+	}
+
+	content, err := os.ReadFile(absPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", &fileError{http.StatusNotFound, "File not found"}
+		}
+		return "", &fileError{http.StatusInternalServerError, "Error reading file: " + err.Error()}
+	}
+	return string(content), nil
+}
+
+// saveFile overwrites or creates a text file and returns its cleaned path
+func saveFile(r *http.Request, projectPath, relPath, content string) (string, *fileError) {
+	relPath, absPath, ferr := projectFile(r, projectPath, relPath)
+	if ferr != nil {
+		return "", ferr
+	}
+
+	// Only text-based files are editable, and only in their own directory
+	if !isTextFile(relPath) {
+		return "", &fileError{http.StatusForbidden, "Access denied: Invalid file type or directory for text editing."}
+	}
+
+	// 0644 is a good default permission for files (rw-r--r--)
+	if err := os.WriteFile(absPath, []byte(content), 0644); err != nil {
+		return "", &fileError{http.StatusInternalServerError, "Error saving file: " + err.Error()}
+	}
+	audit.Record(r, audit.FileSave, filepath.ToSlash(relPath))
+	return relPath, nil
+}
+
+// deleteFile removes a file, or a directory and everything in it
+func deleteFile(r *http.Request, projectPath, relPath string) *fileError {
+	relPath, absPath, ferr := projectFile(r, projectPath, relPath)
+	if ferr != nil {
+		return ferr
+	}
+
+	if isRootDir(filepath.ToSlash(relPath)) {
+		return &fileError{http.StatusForbidden, "Access denied: Cannot delete root directories."}
+	}
+
+	info, err := os.Stat(absPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &fileError{http.StatusNotFound, "File or directory not found"}
+		}
+		return &fileError{http.StatusInternalServerError, "Error accessing path: " + err.Error()}
+	}
+
+	if !isPathAllowed(relPath, info.IsDir()) {
+		return &fileError{http.StatusForbidden, "Access denied: Invalid file type or directory."}
+	}
+
+	if err := os.RemoveAll(absPath); err != nil {
+		return &fileError{http.StatusInternalServerError, "Error deleting file: " + err.Error()}
+	}
+	audit.Record(r, audit.FileDelete, filepath.ToSlash(relPath))
+	return nil
+}
+
+// renameFile gives a file or directory a new name in the same directory and
+// returns its new path. Files keep their extension when newName has none.
+func renameFile(r *http.Request, projectPath, oldRelPath, newName string) (string, *fileError) {
+	if newName == "" {
+		return "", &fileError{http.StatusBadRequest, "Old path and new name are required"}
+	}
+	oldRelPath, absOldPath, ferr := projectFile(r, projectPath, oldRelPath)
+	if ferr != nil {
+		return "", ferr
+	}
+
+	if isRootDir(filepath.ToSlash(oldRelPath)) {
+		return "", &fileError{http.StatusForbidden, "Access denied: Cannot rename root directories."}
+	}
+
+	info, err := os.Stat(absOldPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", &fileError{http.StatusNotFound, "File not found"}
+		}
+		return "", &fileError{http.StatusInternalServerError, "Error accessing file: " + err.Error()}
+	}
+	isDir := info.IsDir()
+
+	if !isPathAllowed(oldRelPath, isDir) {
+		return "", &fileError{http.StatusForbidden, "Access denied: Restricted source."}
+	}
+
+	if !isDir && filepath.Ext(newName) == "" {
+		newName += filepath.Ext(oldRelPath)
+	}
+
+	if strings.Contains(newName, "/") || strings.Contains(newName, "\\") {
+		return "", &fileError{http.StatusBadRequest, "Invalid new name: Must be a filename, not a path."}
+	}
+
+	newRelPath := filepath.Join(filepath.Dir(oldRelPath), newName)
+	if !isPathAllowed(newRelPath, isDir) || !canEditPath(r, newRelPath) {
+		return "", &fileError{http.StatusForbidden, "Access denied: Restricted destination (invalid type or directory)."}
+	}
+
+	absNewPath := filepath.Join(projectPath, newRelPath)
+	if _, err := os.Stat(absNewPath); err == nil {
+		return "", &fileError{http.StatusConflict, "A file with that name already exists."}
+	}
+
+	if err := os.Rename(absOldPath, absNewPath); err != nil {
+		return "", &fileError{http.StatusInternalServerError, "Error renaming file: " + err.Error()}
+	}
+	audit.Record(r, audit.FileRename, filepath.ToSlash(oldRelPath)+" -> "+filepath.ToSlash(newRelPath))
+	return newRelPath, nil
+}
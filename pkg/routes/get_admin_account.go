@@ -0,0 +1,55 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/phillip-england/thispage/pkg/auth"
+	"github.com/phillip-england/thispage/pkg/totp"
+	"github.com/phillip-england/vii/vii"
+)
+
+// totpIssuer names the site in authenticator apps
+const totpIssuer = "thispage"
+
+func GetAdminAccount(w http.ResponseWriter, r *http.Request) {
+	renderAdminAccount(w, r, "", nil)
+}
+
+// renderAdminAccount shows the account page. Users without two-factor login
+// get a freshly generated secret to enroll, unless secret is given because
+// they are retrying a wrong code.
+func renderAdminAccount(w http.ResponseWriter, r *http.Request, secret string, extra map[string]interface{}) {
+	user := auth.CurrentUser(r)
+	data := map[string]interface{}{
+		"User":          user,
+		"Enabled":       user.TwoFactorEnabled(),
+		"RecoveryCount": len(user.RecoveryCodes),
+		"CSRFToken":     auth.CSRFToken(r),
+	}
+
+	if !user.TwoFactorEnabled() {
+		if secret == "" {
+			var err error
+			secret, err = totp.GenerateSecret()
+			if err != nil {
+				vii.WriteError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+		qr, err := totp.QRCode(totp.URI(totpIssuer, user.Username+"@"+r.Host, secret))
+		if err != nil {
+			vii.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		data["Secret"] = secret
+		data["QRCode"] = qr
+	}
+
+	for k, v := range extra {
+		data[k] = v
+	}
+
+	if err := vii.Render(w, r, "admin_account.html", data); err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, err.Error())
+	}
+}
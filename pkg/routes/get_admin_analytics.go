@@ -0,0 +1,45 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/phillip-england/thispage/pkg/analytics"
+	"github.com/phillip-england/thispage/pkg/config"
+	"github.com/phillip-england/vii/vii"
+)
+
+// analyticsPeriods are the ranges offered on the analytics page, in days
+var analyticsPeriods = []int{7, 30, 90}
+
+func GetAdminAnalytics(w http.ResponseWriter, r *http.Request) {
+	cfg := config.Get().Analytics
+
+	days, err := strconv.Atoi(r.URL.Query().Get("days"))
+	if err != nil || days <= 0 {
+		days = 30
+	}
+	if days > cfg.RetentionDays {
+		days = cfg.RetentionDays
+	}
+
+	summary, err := analytics.Summarize(days, 10)
+	if err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, "Failed to load analytics: "+err.Error())
+		return
+	}
+
+	var periods []int
+	for _, period := range analyticsPeriods {
+		if period <= cfg.RetentionDays {
+			periods = append(periods, period)
+		}
+	}
+
+	vii.Render(w, r, "admin_analytics.html", map[string]interface{}{
+		"Summary":       summary,
+		"Periods":       periods,
+		"Enabled":       cfg.Enabled,
+		"RetentionDays": cfg.RetentionDays,
+	})
+}
@@ -0,0 +1,94 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/phillip-england/thispage/pkg/audit"
+	"github.com/phillip-england/thispage/pkg/auth"
+	"github.com/phillip-england/vii/vii"
+)
+
+// auditPageSize caps how many entries the audit page shows; the export has
+// no cap
+const auditPageSize = 500
+
+// GetAdminAudit shows the audit log, newest first, narrowed by the filter
+// form
+func GetAdminAudit(w http.ResponseWriter, r *http.Request) {
+	filter, err := auditFilter(r)
+	if err != nil {
+		vii.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter.Limit = auditPageSize
+
+	entries, err := audit.List(filter)
+	if err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, "Failed to fetch audit log: "+err.Error())
+		return
+	}
+	actors, err := audit.Actors()
+	if err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, "Failed to fetch audit log: "+err.Error())
+		return
+	}
+	actions, err := audit.Actions()
+	if err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, "Failed to fetch audit log: "+err.Error())
+		return
+	}
+
+	// The export links keep the current filter
+	query := url.Values{}
+	for _, key := range []string{"actor", "action", "target", "from", "to"} {
+		if v := r.URL.Query().Get(key); v != "" {
+			query.Set(key, v)
+		}
+	}
+
+	err = vii.Render(w, r, "admin_audit.html", map[string]interface{}{
+		"User":      auth.CurrentUser(r),
+		"Entries":   entries,
+		"Limited":   len(entries) == auditPageSize,
+		"Actors":    actors,
+		"Actions":   actions,
+		"Actor":     r.URL.Query().Get("actor"),
+		"Action":    r.URL.Query().Get("action"),
+		"Target":    r.URL.Query().Get("target"),
+		"From":      r.URL.Query().Get("from"),
+		"To":        r.URL.Query().Get("to"),
+		"Query":     query.Encode(),
+		"CSRFToken": auth.CSRFToken(r),
+	})
+	if err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// auditFilter reads the filter form. from and to are inclusive dates in UTC.
+func auditFilter(r *http.Request) (audit.Filter, error) {
+	q := r.URL.Query()
+	filter := audit.Filter{
+		Actor:  q.Get("actor"),
+		Action: q.Get("action"),
+		Target: q.Get("target"),
+	}
+	if from := q.Get("from"); from != "" {
+		day, err := time.Parse(time.DateOnly, from)
+		if err != nil {
+			return audit.Filter{}, fmt.Errorf("from must be a date like 2006-01-02")
+		}
+		filter.Since = day
+	}
+	if to := q.Get("to"); to != "" {
+		day, err := time.Parse(time.DateOnly, to)
+		if err != nil {
+			return audit.Filter{}, fmt.Errorf("to must be a date like 2006-01-02")
+		}
+		filter.Until = day.AddDate(0, 0, 1)
+	}
+	return filter, nil
+}
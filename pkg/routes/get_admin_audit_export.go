@@ -0,0 +1,75 @@
+package routes
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/phillip-england/thispage/pkg/audit"
+	"github.com/phillip-england/vii/vii"
+)
+
+// GetAdminAuditExport downloads the audit log entries matching the filter
+// form as CSV (the default) or, with format=json, as JSON
+func GetAdminAuditExport(w http.ResponseWriter, r *http.Request) {
+	filter, err := auditFilter(r)
+	if err != nil {
+		vii.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		vii.WriteError(w, http.StatusBadRequest, "format must be csv or json")
+		return
+	}
+
+	entries, err := audit.List(filter)
+	if err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, "Failed to fetch audit log: "+err.Error())
+		return
+	}
+
+	filename := fmt.Sprintf("audit-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Header().Set("Cache-Control", "no-store")
+
+	if format == "json" {
+		if entries == nil {
+			entries = []audit.Entry{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "created_at", "actor", "ip_address", "action", "target"})
+	for _, e := range entries {
+		cw.Write([]string{
+			strconv.FormatInt(e.ID, 10),
+			e.CreatedAt.UTC().Format(time.RFC3339),
+			csvSafe(e.Actor),
+			e.IPAddress,
+			e.Action,
+			csvSafe(e.Target),
+		})
+	}
+	cw.Flush()
+}
+
+// csvSafe keeps spreadsheet apps from running a value that starts like a
+// formula; file names and usernames are chosen by users
+func csvSafe(value string) string {
+	if value != "" && (value[0] == '=' || value[0] == '+' || value[0] == '-' || value[0] == '@') {
+		return "'" + value
+	}
+	return value
+}
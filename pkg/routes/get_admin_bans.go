@@ -0,0 +1,39 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/phillip-england/thispage/pkg/auth"
+	"github.com/phillip-england/thispage/pkg/config"
+	"github.com/phillip-england/thispage/pkg/ratelimit"
+	"github.com/phillip-england/vii/vii"
+)
+
+// GetAdminBans lists the IPs banned for failed logins, including past bans
+// that still make the next one longer
+func GetAdminBans(w http.ResponseWriter, r *http.Request) {
+	bans, err := ratelimit.ListBans()
+	if err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, "Failed to fetch bans: "+err.Error())
+		return
+	}
+
+	active := 0
+	for _, b := range bans {
+		if b.Active() {
+			active++
+		}
+	}
+
+	err = vii.Render(w, r, "admin_bans.html", map[string]interface{}{
+		"User":      auth.CurrentUser(r),
+		"Bans":      bans,
+		"Active":    active,
+		"Allowlist": config.Get().Database.BanAllowlist,
+		"ClientIP":  ratelimit.GetClientIP(r),
+		"CSRFToken": auth.CSRFToken(r),
+	})
+	if err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, err.Error())
+	}
+}
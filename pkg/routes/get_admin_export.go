@@ -4,7 +4,6 @@ import (
 	"archive/zip"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -12,6 +11,7 @@ import (
 	"time"
 
 	"github.com/phillip-england/thispage/pkg/keys"
+	"github.com/phillip-england/thispage/pkg/logging"
 	"github.com/phillip-england/vii/vii"
 )
 
@@ -22,7 +22,8 @@ func GetAdminExport(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("[EXPORT] Starting export of project: %s", projectPath)
+	logger := logging.FromRequest(r).With("component", "export")
+	logger.Info("starting export", "project", projectPath)
 
 	// Directories to export (excludes .thispage, data.db, live)
 	dirsToExport := []string{"templates", "components", "layouts", "static"}
@@ -30,7 +31,7 @@ func GetAdminExport(w http.ResponseWriter, r *http.Request) {
 	// Create a temporary file for the zip
 	tempFile, err := os.CreateTemp("", "thispage-export-*.zip")
 	if err != nil {
-		log.Printf("[EXPORT] Failed to create temp file: %v", err)
+		logger.Error("failed to create temp file", "error", err)
 		vii.WriteError(w, http.StatusInternalServerError, "Failed to create export file")
 		return
 	}
@@ -46,11 +47,11 @@ func GetAdminExport(w http.ResponseWriter, r *http.Request) {
 
 		// Check if directory exists
 		if _, err := os.Stat(srcDir); os.IsNotExist(err) {
-			log.Printf("[EXPORT] Skipping %s (does not exist)", dir)
+			logger.Debug("skipping missing directory", "dir", dir)
 			continue
 		}
 
-		log.Printf("[EXPORT] Adding directory: %s", dir)
+		logger.Debug("adding directory", "dir", dir)
 
 		// Walk the directory and add files
 		err := filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
@@ -111,7 +112,7 @@ func GetAdminExport(w http.ResponseWriter, r *http.Request) {
 		})
 
 		if err != nil {
-			log.Printf("[EXPORT] Error adding %s: %v", dir, err)
+			logger.Error("failed to add directory", "dir", dir, "error", err)
 			zipWriter.Close()
 			tempFile.Close()
 			vii.WriteError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to export %s: %v", dir, err))
@@ -121,7 +122,7 @@ func GetAdminExport(w http.ResponseWriter, r *http.Request) {
 
 	// Close the zip writer
 	if err := zipWriter.Close(); err != nil {
-		log.Printf("[EXPORT] Failed to close zip: %v", err)
+		logger.Error("failed to close zip", "error", err)
 		tempFile.Close()
 		vii.WriteError(w, http.StatusInternalServerError, "Failed to finalize export")
 		return
@@ -140,7 +141,7 @@ func GetAdminExport(w http.ResponseWriter, r *http.Request) {
 	timestamp := time.Now().Format("2006-01-02_150405")
 	filename := fmt.Sprintf("%s_export_%s.zip", projectName, timestamp)
 
-	log.Printf("[EXPORT] Export complete: %s (%d bytes)", filename, fileInfo.Size())
+	logger.Info("export complete", "file", filename, "bytes", fileInfo.Size())
 
 	// Send the file as a download
 	w.Header().Set("Content-Type", "application/zip")
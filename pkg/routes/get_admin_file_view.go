@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/phillip-england/thispage/pkg/auth"
 	"github.com/phillip-england/thispage/pkg/keys"
 	"github.com/phillip-england/vii/vii"
 )
@@ -30,6 +31,12 @@ func GetAdminFileView(w http.ResponseWriter, r *http.Request) {
 	// Normalize to forward slashes for checking
 	slashPath := filepath.ToSlash(relPath)
 
+	// Editors are limited to some directories
+	if !canEditPath(r, relPath) {
+		vii.WriteError(w, http.StatusForbidden, "Access denied: Your role cannot open files in this directory.")
+		return
+	}
+
 	// Security: Check allowed directories and extensions
 	allowed := false
 	isImage := false
@@ -75,6 +82,7 @@ func GetAdminFileView(w http.ResponseWriter, r *http.Request) {
     data := map[string]interface{}{
 		"ProjectPath": projectPath,
 		"FilePath":    relPath,
+		"CSRFToken":   auth.CSRFToken(r),
 	}
 
 	if isImage {
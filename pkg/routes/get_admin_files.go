@@ -7,7 +7,9 @@ import (
 	"sort"
     "strings"
 
+	"github.com/phillip-england/thispage/pkg/auth"
 	"github.com/phillip-england/thispage/pkg/keys"
+	"github.com/phillip-england/thispage/pkg/roles"
 	"github.com/phillip-england/vii/vii"
 )
 
@@ -27,6 +29,13 @@ func GetAdminFiles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user := auth.CurrentUser(r)
+	// Roles without file access land on the messages instead
+	if !roles.Can(user.Role, roles.EditContent) {
+		http.Redirect(w, r, "/admin/messages", http.StatusSeeOther)
+		return
+	}
+
 	root := &FileNode{
 		Name:  filepath.Base(projectPath),
 		IsDir: true,
@@ -34,7 +43,7 @@ func GetAdminFiles(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Only allow specific top-level directories
-	allowedDirs := []string{"components", "templates", "static", "layouts"}
+	allowedDirs := roles.EditableDirs(user.Role, []string{"components", "templates", "static", "layouts"})
     
     var directories []string
 
@@ -67,9 +76,15 @@ func GetAdminFiles(w http.ResponseWriter, r *http.Request) {
     sort.Strings(directories)
 
 	err := vii.Render(w, r, "admin_files.html", map[string]interface{}{
-		"Files":       root,
-		"ProjectPath": projectPath,
-        "Directories": directories,
+		"Files":        root,
+		"ProjectPath":  projectPath,
+        "Directories":  directories,
+		"User":         user,
+		"CanManage":    roles.Can(user.Role, roles.ManageProject),
+		"CanMessages":  roles.Can(user.Role, roles.ReadMessages),
+		"CanAnalytics": roles.Can(user.Role, roles.ViewAnalytics),
+		"CanAudit":     roles.Can(user.Role, roles.ViewAudit),
+		"CSRFToken":    auth.CSRFToken(r),
 	})
 	if err != nil {
 		vii.WriteError(w, http.StatusInternalServerError, err.Error())
@@ -130,6 +145,12 @@ func buildTree(absPath string, node *FileNode, rootDir string, dirs *[]string) e
 	return nil
 }
 
+// canEditPath reports whether the signed-in user's role may touch relPath
+func canEditPath(r *http.Request, relPath string) bool {
+	user := auth.CurrentUser(r)
+	return user != nil && roles.CanEditPath(user.Role, relPath)
+}
+
 func isAllowedFile(relPath string) bool {
 	// Normalize separators
 	relPath = filepath.ToSlash(relPath)
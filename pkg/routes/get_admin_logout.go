@@ -5,11 +5,15 @@ import (
 	"net/url"
 	"strings"
 
+	"github.com/phillip-england/thispage/pkg/audit"
 	"github.com/phillip-england/thispage/pkg/auth"
 	"github.com/phillip-england/vii/vii"
 )
 
 func GetAdminLogout(w http.ResponseWriter, r *http.Request) {
+	if user := auth.Authenticate(r); user != nil {
+		audit.RecordAs(r, user.Username, audit.Logout, "")
+	}
 	_ = auth.DeleteSession(w, r)
 
 	nextPath := sanitizeNextPath(r.URL.Query().Get("next"))
@@ -4,7 +4,9 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/phillip-england/thispage/pkg/auth"
 	"github.com/phillip-england/thispage/pkg/database"
+	"github.com/phillip-england/thispage/pkg/roles"
 	"github.com/phillip-england/vii/vii"
 )
 
@@ -34,6 +36,8 @@ func GetAdminMessageView(w http.ResponseWriter, r *http.Request) {
 	}
 
 	vii.Render(w, r, "admin_message_view.html", map[string]interface{}{
-		"Message": msg,
+		"Message":   msg,
+		"CanDelete": roles.Can(auth.CurrentUser(r).Role, roles.DeleteMessages),
+		"CSRFToken": auth.CSRFToken(r),
 	})
 }
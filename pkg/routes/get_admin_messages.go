@@ -1,31 +1,54 @@
 package routes
 
 import (
+	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/phillip-england/thispage/pkg/auth"
+	"github.com/phillip-england/thispage/pkg/config"
 	"github.com/phillip-england/thispage/pkg/database"
+	"github.com/phillip-england/thispage/pkg/roles"
 	"github.com/phillip-england/vii/vii"
 )
 
 type AdminMessage struct {
-	ID        int
-	IPAddress string
-	Name      string
-	Email     string
-	Message   string
-	CreatedAt time.Time
+	ID        int       `json:"id"`
+	IPAddress string    `json:"ip_address"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 func GetAdminMessages(w http.ResponseWriter, r *http.Request) {
+	messages, err := listMessages()
+	if err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var totalCount int
+	database.DB.QueryRow("SELECT COUNT(*) FROM ADMIN_MESSAGE").Scan(&totalCount)
+
+	vii.Render(w, r, "admin_messages.html", map[string]interface{}{
+		"Messages":   messages,
+		"TotalCount": totalCount,
+		"MaxCount":   config.Get().Database.MaxAdminMessages,
+		"CanDelete":  roles.Can(auth.CurrentUser(r).Role, roles.DeleteMessages),
+		"CSRFToken":  auth.CSRFToken(r),
+	})
+}
+
+// listMessages returns every contact form message, newest first
+func listMessages() ([]AdminMessage, error) {
 	rows, err := database.DB.Query(`
 		SELECT id, ip_address, name, email, message, created_at
 		FROM ADMIN_MESSAGE
 		ORDER BY created_at DESC
 	`)
 	if err != nil {
-		vii.WriteError(w, http.StatusInternalServerError, "Failed to fetch messages: "+err.Error())
-		return
+		return nil, fmt.Errorf("Failed to fetch messages: %w", err)
 	}
 	defer rows.Close()
 
@@ -33,23 +56,13 @@ func GetAdminMessages(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var msg AdminMessage
 		if err := rows.Scan(&msg.ID, &msg.IPAddress, &msg.Name, &msg.Email, &msg.Message, &msg.CreatedAt); err != nil {
-			vii.WriteError(w, http.StatusInternalServerError, "Failed to scan message: "+err.Error())
-			return
+			return nil, fmt.Errorf("Failed to scan message: %w", err)
 		}
 		messages = append(messages, msg)
 	}
 
 	if err := rows.Err(); err != nil {
-		vii.WriteError(w, http.StatusInternalServerError, "Error reading messages: "+err.Error())
-		return
+		return nil, fmt.Errorf("Error reading messages: %w", err)
 	}
-
-	var totalCount int
-	database.DB.QueryRow("SELECT COUNT(*) FROM ADMIN_MESSAGE").Scan(&totalCount)
-
-	vii.Render(w, r, "admin_messages.html", map[string]interface{}{
-		"Messages":   messages,
-		"TotalCount": totalCount,
-		"MaxCount":   database.MaxAdminMessages,
-	})
+	return messages, nil
 }
@@ -0,0 +1,70 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/phillip-england/thispage/pkg/auth"
+	"github.com/phillip-england/thispage/pkg/credentials"
+	"github.com/phillip-england/thispage/pkg/keys"
+	"github.com/phillip-england/thispage/pkg/roles"
+	"github.com/phillip-england/vii/vii"
+)
+
+type AdminSession struct {
+	auth.Session
+	Username string
+	Current  bool
+}
+
+// GetAdminSessions lists where the user is signed in. Owners see every
+// user's sessions.
+func GetAdminSessions(w http.ResponseWriter, r *http.Request) {
+	projectPath, ok := vii.GetContext(keys.ProjectPath, r).(string)
+	if !ok {
+		vii.WriteError(w, http.StatusInternalServerError, "Project path not found in context")
+		return
+	}
+
+	user := auth.CurrentUser(r)
+	showAll := roles.Can(user.Role, roles.ManageProject)
+	filter := user.ID
+	if showAll {
+		filter = ""
+	}
+
+	sessions, err := auth.ListSessions(filter)
+	if err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, "Failed to fetch sessions: "+err.Error())
+		return
+	}
+
+	users, err := credentials.Users(projectPath)
+	if err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, "Failed to load users: "+err.Error())
+		return
+	}
+	usernames := map[string]string{}
+	for _, u := range users {
+		usernames[u.ID] = u.Username
+	}
+
+	currentID := auth.CurrentSessionID(r)
+	var rows []AdminSession
+	for _, s := range sessions {
+		rows = append(rows, AdminSession{
+			Session:  s,
+			Username: usernames[s.UserID],
+			Current:  s.ID == currentID,
+		})
+	}
+
+	err = vii.Render(w, r, "admin_sessions.html", map[string]interface{}{
+		"User":      user,
+		"Sessions":  rows,
+		"ShowAll":   showAll,
+		"CSRFToken": auth.CSRFToken(r),
+	})
+	if err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,74 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/phillip-england/thispage/pkg/apitokens"
+	"github.com/phillip-england/thispage/pkg/auth"
+	"github.com/phillip-england/thispage/pkg/credentials"
+	"github.com/phillip-england/thispage/pkg/keys"
+	"github.com/phillip-england/thispage/pkg/roles"
+	"github.com/phillip-england/vii/vii"
+)
+
+type AdminToken struct {
+	apitokens.Token
+	Username string
+}
+
+// GetAdminTokens lists the user's API tokens. Owners see every user's
+// tokens.
+func GetAdminTokens(w http.ResponseWriter, r *http.Request) {
+	renderAdminTokens(w, r, nil)
+}
+
+func renderAdminTokens(w http.ResponseWriter, r *http.Request, extra map[string]interface{}) {
+	projectPath, ok := vii.GetContext(keys.ProjectPath, r).(string)
+	if !ok {
+		vii.WriteError(w, http.StatusInternalServerError, "Project path not found in context")
+		return
+	}
+
+	user := auth.CurrentUser(r)
+	showAll := roles.Can(user.Role, roles.ManageProject)
+	filter := user.ID
+	if showAll {
+		filter = ""
+	}
+
+	tokens, err := apitokens.List(filter)
+	if err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, "Failed to fetch tokens: "+err.Error())
+		return
+	}
+
+	users, err := credentials.Users(projectPath)
+	if err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, "Failed to load users: "+err.Error())
+		return
+	}
+	usernames := map[string]string{}
+	for _, u := range users {
+		usernames[u.ID] = u.Username
+	}
+
+	var rows []AdminToken
+	for _, t := range tokens {
+		rows = append(rows, AdminToken{Token: t, Username: usernames[t.UserID]})
+	}
+
+	data := map[string]interface{}{
+		"User":      user,
+		"Tokens":    rows,
+		"ShowAll":   showAll,
+		"Scopes":    apitokens.AllowedScopes(user.Role),
+		"CSRFToken": auth.CSRFToken(r),
+	}
+	for k, v := range extra {
+		data[k] = v
+	}
+
+	if err := vii.Render(w, r, "admin_tokens.html", data); err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, err.Error())
+	}
+}
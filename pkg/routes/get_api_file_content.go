@@ -0,0 +1,33 @@
+package routes
+
+import (
+	"net/http"
+	"path/filepath"
+
+	"github.com/phillip-england/thispage/pkg/keys"
+	"github.com/phillip-england/vii/vii"
+)
+
+// APIFileContent is a text file sent to or from the API
+type APIFileContent struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// GetAPIFileContent returns the text file named by the path query parameter
+func GetAPIFileContent(w http.ResponseWriter, r *http.Request) {
+	projectPath, ok := vii.GetContext(keys.ProjectPath, r).(string)
+	if !ok {
+		vii.WriteError(w, http.StatusInternalServerError, "Project path not found in context")
+		return
+	}
+
+	relPath := r.URL.Query().Get("path")
+	content, ferr := readFile(r, projectPath, relPath)
+	if ferr != nil {
+		vii.WriteError(w, ferr.status, ferr.message)
+		return
+	}
+
+	vii.WriteJSON(w, http.StatusOK, APIFileContent{Path: filepath.ToSlash(filepath.Clean(relPath)), Content: content})
+}
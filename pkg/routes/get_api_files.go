@@ -0,0 +1,79 @@
+package routes
+
+import (
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/phillip-england/thispage/pkg/auth"
+	"github.com/phillip-england/thispage/pkg/keys"
+	"github.com/phillip-england/thispage/pkg/roles"
+	"github.com/phillip-england/vii/vii"
+)
+
+// APIFile is one entry of the API's file list
+type APIFile struct {
+	Path       string    `json:"path"`
+	IsDir      bool      `json:"is_dir"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modified_at"`
+}
+
+// GetAPIFiles lists the files the token's user can see in the file manager
+func GetAPIFiles(w http.ResponseWriter, r *http.Request) {
+	projectPath, ok := vii.GetContext(keys.ProjectPath, r).(string)
+	if !ok {
+		vii.WriteError(w, http.StatusInternalServerError, "Project path not found in context")
+		return
+	}
+
+	files := []APIFile{}
+	for _, dirName := range roles.EditableDirs(auth.CurrentUser(r).Role, rootDirs) {
+		absDir := filepath.Join(projectPath, dirName)
+		if info, err := os.Stat(absDir); err != nil || !info.IsDir() {
+			continue
+		}
+
+		err := filepath.WalkDir(absDir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			// Skip hidden files/dirs, as the file manager does
+			if strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			relPath, err := filepath.Rel(projectPath, path)
+			if err != nil {
+				return err
+			}
+			relPath = filepath.ToSlash(relPath)
+			if !d.IsDir() && !isAllowedFile(relPath) {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			file := APIFile{Path: relPath, IsDir: d.IsDir(), ModifiedAt: info.ModTime()}
+			if !d.IsDir() {
+				file.Size = info.Size()
+			}
+			files = append(files, file)
+			return nil
+		})
+		if err != nil {
+			vii.WriteError(w, http.StatusInternalServerError, "Error listing files: "+err.Error())
+			return
+		}
+	}
+
+	vii.WriteJSON(w, http.StatusOK, map[string][]APIFile{"files": files})
+}
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/phillip-england/vii/vii"
+)
+
+// GetAPIMessages lists contact form messages, newest first
+func GetAPIMessages(w http.ResponseWriter, r *http.Request) {
+	messages, err := listMessages()
+	if err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if messages == nil {
+		messages = []AdminMessage{}
+	}
+
+	vii.WriteJSON(w, http.StatusOK, map[string][]AdminMessage{"messages": messages})
+}
@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"net/http"
+)
+
+// GetHealthz reports that the process is up and serving requests
+func GetHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte("ok\n"))
+}
@@ -22,10 +22,10 @@ func GetLogin(w http.ResponseWriter, r *http.Request) {
 	status, err := ratelimit.GetLoginStatus(clientIP)
 	if err == nil {
 		if status.IsBlacklisted {
-			renderData["Error"] = "Your IP has been permanently blocked due to too many failed login attempts."
+			renderData["Error"] = bannedMessage(status.BannedUntil)
 			renderData["IsBlocked"] = true
 		} else if status.FailedAttempts > 0 && status.AttemptsLeft <= 3 {
-			renderData["Warning"] = fmt.Sprintf("Warning: %d attempt(s) remaining before your IP is permanently blocked.", status.AttemptsLeft)
+			renderData["Warning"] = fmt.Sprintf("Warning: %d attempt(s) remaining before your IP is temporarily blocked.", status.AttemptsLeft)
 			renderData["AttemptsLeft"] = status.AttemptsLeft
 		}
 	}
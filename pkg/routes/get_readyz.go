@@ -0,0 +1,63 @@
+package routes
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/phillip-england/thispage/pkg/database"
+	"github.com/phillip-england/thispage/pkg/httpcache"
+	"github.com/phillip-england/thispage/pkg/keys"
+	"github.com/phillip-england/thispage/pkg/tailwind"
+	"github.com/phillip-england/vii/vii"
+)
+
+// GetReadyz reports whether the instance can take traffic: the database
+// answers, the site has been built, and Tailwind is running if it started
+func GetReadyz(w http.ResponseWriter, r *http.Request) {
+	projectPath, ok := vii.GetContext(keys.ProjectPath, r).(string)
+	if !ok {
+		vii.WriteError(w, http.StatusInternalServerError, "Project path not found in context")
+		return
+	}
+	tailwindEnabled, _ := vii.GetContext(keys.TailwindEnabled, r).(bool)
+
+	checks := map[string]string{}
+	ready := true
+
+	if err := database.DB.PingContext(r.Context()); err != nil {
+		slog.Error("readiness check: database unavailable", "error", err)
+		checks["database"] = "unavailable"
+		ready = false
+	} else {
+		checks["database"] = "ok"
+	}
+
+	// The manifest is written at the end of every successful build
+	if _, err := os.Stat(httpcache.ManifestPath(projectPath)); err != nil {
+		checks["build"] = "no successful build"
+		ready = false
+	} else {
+		checks["build"] = "ok"
+	}
+
+	switch {
+	case !tailwindEnabled:
+		checks["tailwind"] = "disabled"
+	case tailwind.IsRunning():
+		checks["tailwind"] = "ok"
+	default:
+		checks["tailwind"] = "not running"
+		ready = false
+	}
+
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	vii.WriteJSON(w, status, map[string]interface{}{
+		"ready":  ready,
+		"checks": checks,
+	})
+}
@@ -0,0 +1,35 @@
+package routes
+
+import (
+	"net/http"
+	"net/netip"
+
+	"github.com/phillip-england/thispage/pkg/audit"
+	"github.com/phillip-england/thispage/pkg/ratelimit"
+	"github.com/phillip-england/vii/vii"
+)
+
+// PostAdminBanDelete lifts an IP's ban and forgets its earlier ones
+func PostAdminBanDelete(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		vii.WriteError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	ip := r.FormValue("ip")
+	if _, err := netip.ParseAddr(ip); err != nil {
+		vii.WriteError(w, http.StatusBadRequest, "Invalid IP address")
+		return
+	}
+
+	removed, err := ratelimit.Unban(ip)
+	if err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, "Failed to unban IP: "+err.Error())
+		return
+	}
+	if removed {
+		audit.Record(r, audit.IPUnban, ip)
+	}
+
+	vii.Redirect(w, r, "/admin/bans", http.StatusSeeOther)
+}
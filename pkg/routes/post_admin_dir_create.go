@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/phillip-england/thispage/pkg/audit"
 	"github.com/phillip-england/thispage/pkg/keys"
 	"github.com/phillip-england/vii/vii"
 )
@@ -34,6 +35,12 @@ func PostAdminDirCreate(w http.ResponseWriter, r *http.Request) {
 	parentDir = filepath.Clean(parentDir)
     parentDirSlash := filepath.ToSlash(parentDir)
 
+	// Editors are limited to some directories
+	if !canEditPath(r, parentDir) {
+		vii.WriteError(w, http.StatusForbidden, "Access denied: Your role cannot change this directory.")
+		return
+	}
+
     // Security: Only allow creating dirs inside allowed roots
     allowed := false
     if strings.HasPrefix(parentDirSlash, "templates") || strings.HasPrefix(parentDirSlash, "components") || strings.HasPrefix(parentDirSlash, "static") || strings.HasPrefix(parentDirSlash, "layouts") {
@@ -72,6 +79,7 @@ func PostAdminDirCreate(w http.ResponseWriter, r *http.Request) {
 		vii.WriteError(w, http.StatusInternalServerError, "Error creating directory: "+err.Error())
 		return
 	}
+	audit.Record(r, audit.DirCreate, filepath.ToSlash(filepath.Join(parentDir, dirname)))
 
 	// Redirect to files list
 	http.Redirect(w, r, "/admin", http.StatusSeeOther)
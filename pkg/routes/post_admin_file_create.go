@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/phillip-england/thispage/pkg/audit"
 	"github.com/phillip-england/thispage/pkg/keys"
 	"github.com/phillip-england/vii/vii"
 )
@@ -44,6 +45,12 @@ func PostAdminFileCreate(w http.ResponseWriter, r *http.Request) {
 	relPath = filepath.Clean(relPath)
 	slashPath := filepath.ToSlash(relPath)
 
+	// Editors are limited to some directories
+	if !canEditPath(r, relPath) {
+		vii.WriteError(w, http.StatusForbidden, "Access denied: Your role cannot change this directory.")
+		return
+	}
+
     // Security: Validate file type based on directory
     allowed := false
     
@@ -102,6 +109,7 @@ func PostAdminFileCreate(w http.ResponseWriter, r *http.Request) {
 		vii.WriteError(w, http.StatusInternalServerError, "Error creating file: "+err.Error())
 		return
 	}
+	audit.Record(r, audit.FileCreate, slashPath)
 
 	// Redirect to files list
 	http.Redirect(w, r, "/admin", http.StatusSeeOther)
@@ -2,7 +2,6 @@ package routes
 
 import (
 	"net/http"
-	"os"
 	"path/filepath"
 	"strings"
 
@@ -23,74 +22,13 @@ func PostAdminFileRename(w http.ResponseWriter, r *http.Request) {
 	}
 
 	oldRelPath := r.FormValue("old_path")
-	newName := r.FormValue("new_name")
-
-	if oldRelPath == "" || newName == "" {
+	if oldRelPath == "" {
 		vii.WriteError(w, http.StatusBadRequest, "Old path and new name are required")
 		return
 	}
 
-	oldRelPath = filepath.Clean(oldRelPath)
-    slashOldPath := filepath.ToSlash(oldRelPath)
-    
-    // Prevent renaming root dirs
-    if slashOldPath == "templates" || slashOldPath == "components" || slashOldPath == "static" || slashOldPath == "layouts" {
-         vii.WriteError(w, http.StatusForbidden, "Access denied: Cannot rename root directories.")
-		 return
-    }
-
-	absOldPath := filepath.Join(projectPath, oldRelPath)
-    info, err := os.Stat(absOldPath)
-    if err != nil {
-         if os.IsNotExist(err) {
-            vii.WriteError(w, http.StatusNotFound, "File not found")
-            return
-        }
-		vii.WriteError(w, http.StatusInternalServerError, "Error accessing file: "+err.Error())
-		return
-    }
-    isDir := info.IsDir()
-
-    // Validate Old Path
-    if !isPathAllowed(oldRelPath, isDir) {
-        vii.WriteError(w, http.StatusForbidden, "Access denied: Restricted source.")
-		return
-    }
-
-    // Auto-append extension for files if missing in newName
-    if !isDir {
-        oldExt := filepath.Ext(oldRelPath)
-        if filepath.Ext(newName) == "" {
-            newName += oldExt
-        }
-    }
-
-    // Construct New Path
-    if strings.Contains(newName, "/") || strings.Contains(newName, "\\") {
-        vii.WriteError(w, http.StatusBadRequest, "Invalid new name: Must be a filename, not a path.")
-		return
-    }
-
-    parentDir := filepath.Dir(oldRelPath)
-    newRelPath := filepath.Join(parentDir, newName)
-
-    // Validate New Path
-    if !isPathAllowed(newRelPath, isDir) {
-        vii.WriteError(w, http.StatusForbidden, "Access denied: Restricted destination (invalid type or directory).")
-		return
-    }
-
-	absNewPath := filepath.Join(projectPath, newRelPath)
-
-    // Check if destination already exists
-    if _, err := os.Stat(absNewPath); err == nil {
-         vii.WriteError(w, http.StatusConflict, "A file with that name already exists.")
-		return
-    }
-
-	err = os.Rename(absOldPath, absNewPath)
-	if err != nil {
-		vii.WriteError(w, http.StatusInternalServerError, "Error renaming file: "+err.Error())
+	if _, ferr := renameFile(r, projectPath, oldRelPath, r.FormValue("new_name")); ferr != nil {
+		vii.WriteError(w, ferr.status, ferr.message)
 		return
 	}
 
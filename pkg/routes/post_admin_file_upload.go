@@ -7,6 +7,8 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/phillip-england/thispage/pkg/audit"
+	"github.com/phillip-england/thispage/pkg/config"
 	"github.com/phillip-england/thispage/pkg/keys"
 	"github.com/phillip-england/vii/vii"
 )
@@ -18,8 +20,10 @@ func PostAdminFileUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 10 MB limit
-	r.ParseMultipartForm(10 << 20)
+	// Size limit from uploads.max_file_size_mb
+	maxSize := int64(config.Get().Uploads.MaxFileSizeMB) << 20
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+	r.ParseMultipartForm(maxSize)
 
 	file, handler, err := r.FormFile("file")
 	if err != nil {
@@ -40,6 +44,12 @@ func PostAdminFileUpload(w http.ResponseWriter, r *http.Request) {
     relPath := filepath.Join(destDir, handler.Filename)
     slashPath := filepath.ToSlash(relPath)
 
+	// Editors are limited to some directories
+	if !canEditPath(r, relPath) {
+		vii.WriteError(w, http.StatusForbidden, "Access denied: Your role cannot change this directory.")
+		return
+	}
+
     // Security: Validate file type based on directory
     allowed := false
     
@@ -93,6 +103,7 @@ func PostAdminFileUpload(w http.ResponseWriter, r *http.Request) {
 		vii.WriteError(w, http.StatusInternalServerError, "Error saving file: "+err.Error())
 		return
 	}
+	audit.Record(r, audit.FileUpload, slashPath)
 
 	http.Redirect(w, r, "/admin", http.StatusSeeOther)
 }
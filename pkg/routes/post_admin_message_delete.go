@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/phillip-england/thispage/pkg/audit"
 	"github.com/phillip-england/thispage/pkg/database"
 	"github.com/phillip-england/vii/vii"
 )
@@ -29,7 +30,13 @@ func PostAdminMessageDelete(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
-		database.DB.Exec("DELETE FROM ADMIN_MESSAGE WHERE id = ?", id)
+		result, err := database.DB.Exec("DELETE FROM ADMIN_MESSAGE WHERE id = ?", id)
+		if err != nil {
+			continue
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			audit.Record(r, audit.MessageDelete, strconv.Itoa(id))
+		}
 	}
 
 	vii.Redirect(w, r, "/admin/messages", http.StatusSeeOther)
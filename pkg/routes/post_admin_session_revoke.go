@@ -0,0 +1,48 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/phillip-england/thispage/pkg/audit"
+	"github.com/phillip-england/thispage/pkg/auth"
+	"github.com/phillip-england/thispage/pkg/roles"
+	"github.com/phillip-england/vii/vii"
+)
+
+// PostAdminSessionRevoke ends one session. Owners may end anyone's session,
+// everyone else only their own.
+func PostAdminSessionRevoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		vii.WriteError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil {
+		vii.WriteError(w, http.StatusBadRequest, "Invalid session id")
+		return
+	}
+
+	user := auth.CurrentUser(r)
+	owner := user.ID
+	if roles.Can(user.Role, roles.ManageProject) {
+		owner = ""
+	}
+
+	current := id == auth.CurrentSessionID(r)
+	revoked, err := auth.RevokeSession(id, owner)
+	if err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, "Failed to revoke session: "+err.Error())
+		return
+	}
+	if revoked {
+		audit.Record(r, audit.SessionRevoke, strconv.FormatInt(id, 10))
+	}
+
+	if current {
+		vii.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	vii.Redirect(w, r, "/admin/sessions", http.StatusSeeOther)
+}
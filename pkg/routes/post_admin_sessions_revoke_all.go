@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/phillip-england/thispage/pkg/audit"
+	"github.com/phillip-england/thispage/pkg/auth"
+	"github.com/phillip-england/vii/vii"
+)
+
+// PostAdminSessionsRevokeAll logs the user out everywhere, this browser included
+func PostAdminSessionsRevokeAll(w http.ResponseWriter, r *http.Request) {
+	if _, err := auth.RevokeUserSessions(auth.CurrentUser(r).ID); err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, "Failed to revoke sessions: "+err.Error())
+		return
+	}
+	audit.Record(r, audit.SessionsRevokeAll, auth.CurrentUser(r).Username)
+	_ = auth.DeleteSession(w, r)
+
+	vii.Redirect(w, r, "/login", http.StatusSeeOther)
+}
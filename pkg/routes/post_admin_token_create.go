@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/phillip-england/thispage/pkg/apitokens"
+	"github.com/phillip-england/thispage/pkg/audit"
+	"github.com/phillip-england/thispage/pkg/auth"
+	"github.com/phillip-england/thispage/pkg/forms"
+)
+
+// PostAdminTokenCreate makes an API token and shows its secret once
+func PostAdminTokenCreate(w http.ResponseWriter, r *http.Request) {
+	validator := forms.FormAdminToken{}
+	data, err := validator.Validate(r)
+	if err != nil {
+		renderAdminTokens(w, r, map[string]interface{}{"Error": err.Error()})
+		return
+	}
+
+	token, err := apitokens.Create(auth.CurrentUser(r), data.Name, data.Scopes)
+	if err != nil {
+		renderAdminTokens(w, r, map[string]interface{}{"Error": err.Error()})
+		return
+	}
+
+	audit.Record(r, audit.TokenCreate, data.Name)
+	renderAdminTokens(w, r, map[string]interface{}{"NewToken": token})
+}
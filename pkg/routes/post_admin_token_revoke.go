@@ -0,0 +1,44 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/phillip-england/thispage/pkg/apitokens"
+	"github.com/phillip-england/thispage/pkg/audit"
+	"github.com/phillip-england/thispage/pkg/auth"
+	"github.com/phillip-england/thispage/pkg/roles"
+	"github.com/phillip-england/vii/vii"
+)
+
+// PostAdminTokenRevoke deletes an API token. Owners may revoke anyone's
+// token, everyone else only their own.
+func PostAdminTokenRevoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		vii.WriteError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil {
+		vii.WriteError(w, http.StatusBadRequest, "Invalid token id")
+		return
+	}
+
+	user := auth.CurrentUser(r)
+	owner := user.ID
+	if roles.Can(user.Role, roles.ManageProject) {
+		owner = ""
+	}
+
+	revoked, err := apitokens.Revoke(id, owner)
+	if err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, "Failed to revoke token: "+err.Error())
+		return
+	}
+	if revoked {
+		audit.Record(r, audit.TokenRevoke, strconv.FormatInt(id, 10))
+	}
+
+	vii.Redirect(w, r, "/admin/tokens", http.StatusSeeOther)
+}
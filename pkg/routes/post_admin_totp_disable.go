@@ -0,0 +1,57 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/phillip-england/thispage/pkg/audit"
+	"github.com/phillip-england/thispage/pkg/auth"
+	"github.com/phillip-england/thispage/pkg/credentials"
+	"github.com/phillip-england/thispage/pkg/forms"
+	"github.com/phillip-england/thispage/pkg/keys"
+	"github.com/phillip-england/vii/vii"
+)
+
+// PostAdminTOTPDisable turns off two-factor login. It asks for a current code
+// so a session left open on a shared machine cannot quietly remove it.
+func PostAdminTOTPDisable(w http.ResponseWriter, r *http.Request) {
+	user := auth.CurrentUser(r)
+	if !user.TwoFactorEnabled() {
+		vii.Redirect(w, r, "/admin/account", http.StatusSeeOther)
+		return
+	}
+
+	validator := forms.FormAdminTOTP{}
+	data, err := validator.Validate(r)
+	if err != nil {
+		renderAdminAccount(w, r, "", map[string]interface{}{"Error": "Invalid form data"})
+		return
+	}
+
+	projectPath, ok := vii.GetContext(keys.ProjectPath, r).(string)
+	if !ok {
+		vii.WriteError(w, http.StatusInternalServerError, "Project path not found in context")
+		return
+	}
+
+	valid, err := credentials.VerifySecondFactor(projectPath, user.ID, data.Code)
+	if err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, "Failed to check code: "+err.Error())
+		return
+	}
+	if !valid {
+		renderAdminAccount(w, r, "", map[string]interface{}{"Error": "Invalid code"})
+		return
+	}
+
+	if _, err := credentials.DisableTOTP(projectPath, user.Username); err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, "Failed to disable two-factor login: "+err.Error())
+		return
+	}
+	audit.Record(r, audit.TOTPDisable, user.Username)
+	if err := auth.RotateSession(w, r); err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, "Failed to rotate session: "+err.Error())
+		return
+	}
+
+	vii.Redirect(w, r, "/admin/account", http.StatusSeeOther)
+}
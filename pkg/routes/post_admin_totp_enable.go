@@ -0,0 +1,66 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/phillip-england/thispage/pkg/audit"
+	"github.com/phillip-england/thispage/pkg/auth"
+	"github.com/phillip-england/thispage/pkg/credentials"
+	"github.com/phillip-england/thispage/pkg/forms"
+	"github.com/phillip-england/thispage/pkg/keys"
+	"github.com/phillip-england/thispage/pkg/totp"
+	"github.com/phillip-england/vii/vii"
+)
+
+// PostAdminTOTPEnable turns on two-factor login once the user proves their
+// authenticator app works, then shows their recovery codes once
+func PostAdminTOTPEnable(w http.ResponseWriter, r *http.Request) {
+	user := auth.CurrentUser(r)
+	if user.TwoFactorEnabled() {
+		vii.Redirect(w, r, "/admin/account", http.StatusSeeOther)
+		return
+	}
+
+	validator := forms.FormAdminTOTPEnable{}
+	data, err := validator.Validate(r)
+	if err != nil {
+		renderAdminAccount(w, r, "", map[string]interface{}{"Error": "Invalid form data"})
+		return
+	}
+
+	counter, ok := totp.Validate(data.Secret, data.Code, time.Now(), 0)
+	if !ok {
+		renderAdminAccount(w, r, data.Secret, map[string]interface{}{"Error": "That code did not match, try again"})
+		return
+	}
+
+	projectPath, ok := vii.GetContext(keys.ProjectPath, r).(string)
+	if !ok {
+		vii.WriteError(w, http.StatusInternalServerError, "Project path not found in context")
+		return
+	}
+
+	codes, hashes, err := totp.GenerateRecoveryCodes()
+	if err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := credentials.EnableTOTP(projectPath, user.ID, data.Secret, counter, hashes); err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, "Failed to enable two-factor login: "+err.Error())
+		return
+	}
+	audit.Record(r, audit.TOTPEnable, user.Username)
+	if err := auth.RotateSession(w, r); err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, "Failed to rotate session: "+err.Error())
+		return
+	}
+
+	vii.Render(w, r, "admin_account.html", map[string]interface{}{
+		"User":          user,
+		"Enabled":       true,
+		"RecoveryCount": len(codes),
+		"RecoveryCodes": codes,
+		"CSRFToken":     auth.CSRFToken(r),
+	})
+}
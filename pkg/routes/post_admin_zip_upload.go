@@ -4,14 +4,17 @@ import (
 	"archive/zip"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/phillip-england/thispage/pkg/audit"
 	"github.com/phillip-england/thispage/pkg/compiler"
+	"github.com/phillip-england/thispage/pkg/config"
 	"github.com/phillip-england/thispage/pkg/keys"
+	"github.com/phillip-england/thispage/pkg/logging"
 	"github.com/phillip-england/thispage/pkg/tailwind"
 	"github.com/phillip-england/vii/vii"
 )
@@ -23,24 +26,27 @@ func PostAdminZipUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("[ZIP DEPLOY] Starting deploy to project: %s", projectPath)
+	logger := logging.FromRequest(r).With("component", "zip_deploy")
+	logger.Info("starting deploy", "project", projectPath)
 
-	// 50 MB limit for zip files
-	if err := r.ParseMultipartForm(50 << 20); err != nil {
-		log.Printf("[ZIP DEPLOY] Error parsing form: %v", err)
+	// Size limit from uploads.max_zip_size_mb
+	maxSize := int64(config.Get().Uploads.MaxZipSizeMB) << 20
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+	if err := r.ParseMultipartForm(maxSize); err != nil {
+		logger.Warn("error parsing form", "error", err)
 		vii.WriteError(w, http.StatusBadRequest, "File too large or invalid form: "+err.Error())
 		return
 	}
 
 	file, handler, err := r.FormFile("zipfile")
 	if err != nil {
-		log.Printf("[ZIP DEPLOY] Error retrieving file: %v", err)
+		logger.Warn("error retrieving file", "error", err)
 		vii.WriteError(w, http.StatusBadRequest, "Error retrieving zip file: "+err.Error())
 		return
 	}
 	defer file.Close()
 
-	log.Printf("[ZIP DEPLOY] Received file: %s (size: %d bytes)", handler.Filename, handler.Size)
+	logger.Info("received file", "file", handler.Filename, "bytes", handler.Size)
 
 	// Validate it's a zip file
 	if !strings.HasSuffix(strings.ToLower(handler.Filename), ".zip") {
@@ -51,13 +57,13 @@ func PostAdminZipUpload(w http.ResponseWriter, r *http.Request) {
 	// Create temp directory for extraction
 	tempDir, err := os.MkdirTemp("", "thispage-zip-*")
 	if err != nil {
-		log.Printf("[ZIP DEPLOY] Failed to create temp dir: %v", err)
+		logger.Error("failed to create temp dir", "error", err)
 		vii.WriteError(w, http.StatusInternalServerError, "Failed to create temp directory: "+err.Error())
 		return
 	}
 	defer os.RemoveAll(tempDir)
 
-	log.Printf("[ZIP DEPLOY] Created temp dir: %s", tempDir)
+	logger.Debug("created temp dir", "path", tempDir)
 
 	// Save uploaded zip to temp file
 	tempZipPath := filepath.Join(tempDir, "upload.zip")
@@ -75,12 +81,12 @@ func PostAdminZipUpload(w http.ResponseWriter, r *http.Request) {
 	}
 	tempZipFile.Close()
 
-	log.Printf("[ZIP DEPLOY] Saved %d bytes to temp file", bytesWritten)
+	logger.Debug("saved upload to temp file", "bytes", bytesWritten)
 
 	// Open and extract zip
 	zipReader, err := zip.OpenReader(tempZipPath)
 	if err != nil {
-		log.Printf("[ZIP DEPLOY] Failed to open zip: %v", err)
+		logger.Warn("failed to open zip", "error", err)
 		vii.WriteError(w, http.StatusBadRequest, "Failed to open zip file: "+err.Error())
 		return
 	}
@@ -92,7 +98,7 @@ func PostAdminZipUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("[ZIP DEPLOY] Extracting %d files from zip...", len(zipReader.File))
+	logger.Info("extracting zip", "files", len(zipReader.File))
 
 	// Extract all files
 	for _, f := range zipReader.File {
@@ -112,7 +118,7 @@ func PostAdminZipUpload(w http.ResponseWriter, r *http.Request) {
 		absExtractDir, _ := filepath.Abs(extractDir)
 		absDestPath, _ := filepath.Abs(destPath)
 		if !strings.HasPrefix(absDestPath, absExtractDir) {
-			log.Printf("[ZIP DEPLOY] Zip slip attempt detected: %s", f.Name)
+			logger.Warn("zip slip attempt detected", "name", f.Name)
 			vii.WriteError(w, http.StatusBadRequest, "Invalid file path in zip (zip slip attempt)")
 			return
 		}
@@ -153,21 +159,21 @@ func PostAdminZipUpload(w http.ResponseWriter, r *http.Request) {
 
 	// List what was extracted for debugging
 	extractedItems, _ := os.ReadDir(extractDir)
-	log.Printf("[ZIP DEPLOY] Extracted items in root: %d", len(extractedItems))
+	logger.Debug("extracted items in root", "count", len(extractedItems))
 	for _, item := range extractedItems {
-		log.Printf("[ZIP DEPLOY]   - %s (dir: %v)", item.Name(), item.IsDir())
+		logger.Debug("extracted item", "name", item.Name(), "dir", item.IsDir())
 	}
 
 	// Find the root of the thispage project in the extracted files
 	// It could be directly in extractDir, or in a subdirectory (common when zipping a folder)
-	projectRoot := findThispageRoot(extractDir)
+	projectRoot := findThispageRoot(logger, extractDir)
 	if projectRoot == "" {
-		log.Printf("[ZIP DEPLOY] Could not find valid thispage project in zip")
+		logger.Warn("could not find a thispage project in zip")
 		vii.WriteError(w, http.StatusBadRequest, "Zip does not contain a valid thispage project (missing templates/, components/, layouts/, or static/ directories)")
 		return
 	}
 
-	log.Printf("[ZIP DEPLOY] Found project root: %s", projectRoot)
+	logger.Info("found project root", "path", projectRoot)
 
 	// Directories to replace (these are the content directories)
 	dirsToReplace := []string{"templates", "components", "layouts", "static"}
@@ -179,70 +185,72 @@ func PostAdminZipUpload(w http.ResponseWriter, r *http.Request) {
 
 		// Check if source directory exists in zip
 		if _, err := os.Stat(srcDir); os.IsNotExist(err) {
-			log.Printf("[ZIP DEPLOY] Skipping %s (not in zip)", dir)
+			logger.Debug("skipping directory not in zip", "dir", dir)
 			continue
 		}
 
-		log.Printf("[ZIP DEPLOY] Replacing %s...", dir)
+		logger.Info("replacing directory", "dir", dir)
 
 		// Remove existing directory
 		if err := os.RemoveAll(dstDir); err != nil {
-			log.Printf("[ZIP DEPLOY] Failed to remove %s: %v", dir, err)
+			logger.Error("failed to remove directory", "dir", dir, "error", err)
 			vii.WriteError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to remove existing %s directory: %v", dir, err))
 			return
 		}
 
 		// Copy new directory
-		if err := copyDir(srcDir, dstDir); err != nil {
-			log.Printf("[ZIP DEPLOY] Failed to copy %s: %v", dir, err)
+		if err := copyDir(logger, srcDir, dstDir); err != nil {
+			logger.Error("failed to copy directory", "dir", dir, "error", err)
 			vii.WriteError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to copy %s directory: %v", dir, err))
 			return
 		}
 
-		log.Printf("[ZIP DEPLOY] Successfully replaced %s", dir)
+		logger.Debug("replaced directory", "dir", dir)
 	}
 
 	// Build Tailwind CSS first (one-time build)
-	log.Printf("[ZIP DEPLOY] Building Tailwind CSS...")
+	logger.Info("building Tailwind CSS")
 	if err := tailwind.BuildOnce(projectPath); err != nil {
-		log.Printf("[ZIP DEPLOY] Tailwind build warning: %v", err)
+		logger.Warn("Tailwind build failed", "error", err)
 		// Don't fail on Tailwind errors - the project might not use Tailwind
 	}
 
+	audit.Record(r, audit.ProjectDeploy, handler.Filename)
+
 	// Restart Tailwind watch process
-	log.Printf("[ZIP DEPLOY] Restarting Tailwind watch process...")
+	logger.Info("restarting Tailwind watch process")
 	if err := tailwind.RestartWatch(); err != nil {
-		log.Printf("[ZIP DEPLOY] Tailwind restart warning: %v", err)
+		logger.Warn("Tailwind restart failed", "error", err)
 		// Don't fail on Tailwind errors
 	}
 
 	// Trigger template rebuild
-	log.Printf("[ZIP DEPLOY] Rebuilding templates...")
+	logger.Info("rebuilding templates")
 	if err := compiler.Build(projectPath); err != nil {
-		log.Printf("[ZIP DEPLOY] Rebuild failed: %v", err)
+		logger.Error("rebuild failed", "error", err)
 		vii.WriteError(w, http.StatusInternalServerError, "Project updated but rebuild failed: "+err.Error())
 		return
 	}
 
-	log.Printf("[ZIP DEPLOY] Deploy completed successfully!")
+	logger.Info("deploy completed")
 	http.Redirect(w, r, "/admin", http.StatusSeeOther)
 }
 
 // findThispageRoot looks for a directory containing templates/, components/, layouts/, or static/
 // It searches recursively up to maxDepth levels deep
-func findThispageRoot(extractDir string) string {
-	log.Printf("[ZIP DEPLOY] Looking for thispage project in: %s", extractDir)
-	return findThispageRootRecursive(extractDir, 0, 5) // Search up to 5 levels deep
+func findThispageRoot(logger *slog.Logger, extractDir string) string {
+	logger.Debug("looking for thispage project", "path", extractDir)
+	return findThispageRootRecursive(logger, extractDir, 0, 5) // Search up to 5 levels deep
 }
 
-func findThispageRootRecursive(dir string, depth int, maxDepth int) string {
+func findThispageRootRecursive(logger *slog.Logger, dir string, depth int, maxDepth int) string {
 	if depth > maxDepth {
 		return ""
 	}
 
 	// Check if this directory is a thispage project
-	if isThispageProject(dir) {
-		log.Printf("[ZIP DEPLOY] Found project at depth %d: %s", depth, dir)
+	if isThispageProject(logger, dir) {
+		logger.Debug("found project", "depth", depth, "path", dir)
 		return dir
 	}
 
@@ -261,9 +269,9 @@ func findThispageRootRecursive(dir string, depth int, maxDepth int) string {
 			}
 
 			subDir := filepath.Join(dir, name)
-			log.Printf("[ZIP DEPLOY] Checking subdirectory at depth %d: %s", depth+1, name)
+			logger.Debug("checking subdirectory", "depth", depth+1, "name", name)
 
-			result := findThispageRootRecursive(subDir, depth+1, maxDepth)
+			result := findThispageRootRecursive(logger, subDir, depth+1, maxDepth)
 			if result != "" {
 				return result
 			}
@@ -274,7 +282,7 @@ func findThispageRootRecursive(dir string, depth int, maxDepth int) string {
 }
 
 // isThispageProject checks if a directory looks like a thispage project
-func isThispageProject(dir string) bool {
+func isThispageProject(logger *slog.Logger, dir string) bool {
 	// Must have at least one of these directories
 	requiredDirs := []string{"templates", "components", "layouts", "static"}
 	foundCount := 0
@@ -287,43 +295,43 @@ func isThispageProject(dir string) bool {
 		}
 	}
 
-	log.Printf("[ZIP DEPLOY] isThispageProject(%s): found %d dirs: %v", filepath.Base(dir), foundCount, foundDirs)
+	logger.Debug("checked for project directories", "dir", filepath.Base(dir), "found", foundDirs)
 
 	// Require at least 2 of the expected directories to be present
 	return foundCount >= 2
 }
 
 // copyDir recursively copies a directory
-func copyDir(src, dst string) error {
+func copyDir(logger *slog.Logger, src, dst string) error {
 	srcInfo, err := os.Stat(src)
 	if err != nil {
-		log.Printf("[ZIP DEPLOY] copyDir: failed to stat src %s: %v", src, err)
+		logger.Error("copyDir: failed to stat source", "path", src, "error", err)
 		return err
 	}
 
 	if err := os.MkdirAll(dst, srcInfo.Mode()); err != nil {
-		log.Printf("[ZIP DEPLOY] copyDir: failed to create dst %s: %v", dst, err)
+		logger.Error("copyDir: failed to create destination", "path", dst, "error", err)
 		return err
 	}
 
 	entries, err := os.ReadDir(src)
 	if err != nil {
-		log.Printf("[ZIP DEPLOY] copyDir: failed to read src %s: %v", src, err)
+		logger.Error("copyDir: failed to read source", "path", src, "error", err)
 		return err
 	}
 
-	log.Printf("[ZIP DEPLOY] copyDir: copying %d items from %s to %s", len(entries), filepath.Base(src), filepath.Base(dst))
+	logger.Debug("copyDir: copying", "items", len(entries), "from", filepath.Base(src), "to", filepath.Base(dst))
 
 	for _, entry := range entries {
 		srcPath := filepath.Join(src, entry.Name())
 		dstPath := filepath.Join(dst, entry.Name())
 
 		if entry.IsDir() {
-			if err := copyDir(srcPath, dstPath); err != nil {
+			if err := copyDir(logger, srcPath, dstPath); err != nil {
 				return err
 			}
 		} else {
-			log.Printf("[ZIP DEPLOY] copyFile: %s", entry.Name())
+			logger.Debug("copyFile", "name", entry.Name())
 			if err := copyFile(srcPath, dstPath); err != nil {
 				return err
 			}
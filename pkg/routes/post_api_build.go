@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/phillip-england/thispage/pkg/audit"
+	"github.com/phillip-england/thispage/pkg/compiler"
+	"github.com/phillip-england/thispage/pkg/keys"
+	"github.com/phillip-england/vii/vii"
+)
+
+// PostAPIBuild rebuilds the site and reports whether it worked
+func PostAPIBuild(w http.ResponseWriter, r *http.Request) {
+	projectPath, ok := vii.GetContext(keys.ProjectPath, r).(string)
+	if !ok {
+		vii.WriteError(w, http.StatusInternalServerError, "Project path not found in context")
+		return
+	}
+
+	if err := compiler.Build(projectPath); err != nil {
+		vii.WriteError(w, http.StatusUnprocessableEntity, "Build failed: "+err.Error())
+		return
+	}
+
+	audit.Record(r, audit.SiteBuild, "")
+	vii.WriteJSON(w, http.StatusOK, map[string]string{"status": "built"})
+}
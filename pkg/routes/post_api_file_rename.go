@@ -0,0 +1,35 @@
+package routes
+
+import (
+	"net/http"
+	"path/filepath"
+
+	"github.com/phillip-england/thispage/pkg/keys"
+	"github.com/phillip-england/vii/vii"
+)
+
+// PostAPIFileRename renames a file or directory in place
+func PostAPIFileRename(w http.ResponseWriter, r *http.Request) {
+	projectPath, ok := vii.GetContext(keys.ProjectPath, r).(string)
+	if !ok {
+		vii.WriteError(w, http.StatusInternalServerError, "Project path not found in context")
+		return
+	}
+
+	var body struct {
+		Path    string `json:"path"`
+		NewName string `json:"new_name"`
+	}
+	if err := vii.ReadJSON(r, &body); err != nil {
+		vii.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	newRelPath, ferr := renameFile(r, projectPath, body.Path, body.NewName)
+	if ferr != nil {
+		vii.WriteError(w, ferr.status, ferr.message)
+		return
+	}
+
+	vii.WriteJSON(w, http.StatusOK, map[string]string{"path": filepath.ToSlash(newRelPath)})
+}
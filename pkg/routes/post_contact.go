@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/phillip-england/thispage/pkg/config"
 	"github.com/phillip-england/thispage/pkg/database"
 	"github.com/phillip-england/thispage/pkg/forms"
 	"github.com/phillip-england/thispage/pkg/ratelimit"
@@ -77,7 +78,7 @@ func getMessagesRemainingToday(ip string) (int, error) {
 		return 0, err
 	}
 
-	remaining := database.MaxMessagesPerIPPerDay - count
+	remaining := config.Get().Database.MaxMessagesPerIPPerDay - count
 	if remaining < 0 {
 		remaining = 0
 	}
@@ -92,7 +93,7 @@ func evictOldestMessage() error {
 		return err
 	}
 
-	if count >= database.MaxAdminMessages {
+	if count >= config.Get().Database.MaxAdminMessages {
 		_, err = database.DB.Exec(`
 			DELETE FROM ADMIN_MESSAGE
 			WHERE id = (SELECT id FROM ADMIN_MESSAGE ORDER BY created_at ASC LIMIT 1)
@@ -3,7 +3,9 @@ package routes
 import (
 	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/phillip-england/thispage/pkg/audit"
 	"github.com/phillip-england/thispage/pkg/auth"
 	"github.com/phillip-england/thispage/pkg/credentials"
 	"github.com/phillip-england/thispage/pkg/database"
@@ -25,8 +27,8 @@ func PostLogin(w http.ResponseWriter, r *http.Request) {
 
 	if status.IsBlacklisted {
 		vii.Render(w, r, "admin_login.html", map[string]interface{}{
-			"Error":       "Your IP has been permanently blocked due to too many failed login attempts.",
-			"IsBlocked":   true,
+			"Error":     bannedMessage(status.BannedUntil),
+			"IsBlocked": true,
 		})
 		return
 	}
@@ -44,51 +46,24 @@ func PostLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	adminUsername, adminPassword, err := credentials.Load(projectPath)
+	user, err := credentials.Verify(projectPath, data.Username, data.Password)
 	if err != nil {
 		vii.WriteError(w, http.StatusInternalServerError, "Failed to load credentials: "+err.Error())
 		return
 	}
 
-	if data.Username != adminUsername || data.Password != adminPassword {
-		// Record failed attempt
-		shouldBlacklist, err := ratelimit.RecordAttempt(clientIP, false)
-		if err != nil {
-			vii.WriteError(w, http.StatusInternalServerError, "Failed to record login attempt: "+err.Error())
-			return
-		}
+	if user == nil {
+		renderLoginFailure(w, r, clientIP, "Invalid credentials", nil)
+		return
+	}
 
-		if shouldBlacklist {
-			// Add to blacklist
-			if err := ratelimit.AddToBlacklist(clientIP); err != nil {
-				vii.WriteError(w, http.StatusInternalServerError, "Failed to update blacklist: "+err.Error())
-				return
-			}
-			vii.Render(w, r, "admin_login.html", map[string]interface{}{
-				"Error":     "Too many failed login attempts. Your IP has been permanently blocked.",
-				"IsBlocked": true,
-			})
+	// Users with two-factor login enabled still need to enter a code
+	if user.TwoFactorEnabled() {
+		if err := auth.CreateChallenge(w, r, user); err != nil {
+			vii.WriteError(w, http.StatusInternalServerError, "Failed to start two-factor login: "+err.Error())
 			return
 		}
-
-		// Get updated status for warning
-		newStatus, _ := ratelimit.GetLoginStatus(clientIP)
-		attemptsLeft := newStatus.AttemptsLeft
-
-		renderData := map[string]interface{}{
-			"Error": "Invalid credentials",
-		}
-
-		// Show warning if they're getting close to being locked out
-		if attemptsLeft <= 3 && attemptsLeft > 0 {
-			renderData["Warning"] = fmt.Sprintf("Warning: %d attempt(s) remaining before your IP is permanently blocked.", attemptsLeft)
-			renderData["AttemptsLeft"] = attemptsLeft
-		} else if attemptsLeft == 0 {
-			renderData["Warning"] = "This is your final attempt. You will be locked out after this."
-			renderData["AttemptsLeft"] = 0
-		}
-
-		vii.Render(w, r, "admin_login.html", renderData)
+		vii.Render(w, r, "admin_login.html", map[string]interface{}{"TwoFactor": true})
 		return
 	}
 
@@ -97,15 +72,69 @@ func PostLogin(w http.ResponseWriter, r *http.Request) {
 	ratelimit.ClearAttemptsForIP(clientIP)
 
 	// Create Session
-	if err := auth.CreateSession(w, r); err != nil {
+	if err := auth.CreateSession(w, r, user); err != nil {
 		vii.WriteError(w, http.StatusInternalServerError, "Failed to create session: "+err.Error())
 		return
 	}
+	audit.RecordAs(r, user.Username, audit.Login, "")
 
 	// Success
 	vii.Redirect(w, r, "/admin", http.StatusSeeOther)
 }
 
+// renderLoginFailure records a failed attempt for clientIP, blacklisting it
+// once it has too many, and renders the login page with msg. Extra values are
+// merged into the page data.
+func renderLoginFailure(w http.ResponseWriter, r *http.Request, clientIP, msg string, extra map[string]interface{}) {
+	shouldBlacklist, err := ratelimit.RecordAttempt(clientIP, false)
+	if err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, "Failed to record login attempt: "+err.Error())
+		return
+	}
+
+	if shouldBlacklist {
+		// Add to blacklist
+		until, err := ratelimit.AddToBlacklist(clientIP)
+		if err != nil {
+			vii.WriteError(w, http.StatusInternalServerError, "Failed to update blacklist: "+err.Error())
+			return
+		}
+		auth.DeleteChallenge(w, r)
+		vii.Render(w, r, "admin_login.html", map[string]interface{}{
+			"Error":     bannedMessage(until),
+			"IsBlocked": true,
+		})
+		return
+	}
+
+	// Get updated status for warning
+	newStatus, _ := ratelimit.GetLoginStatus(clientIP)
+	attemptsLeft := newStatus.AttemptsLeft
+
+	renderData := map[string]interface{}{
+		"Error": msg,
+	}
+	for k, v := range extra {
+		renderData[k] = v
+	}
+
+	// Show warning if they're getting close to being locked out
+	if attemptsLeft <= 3 && attemptsLeft > 0 {
+		renderData["Warning"] = fmt.Sprintf("Warning: %d attempt(s) remaining before your IP is temporarily blocked.", attemptsLeft)
+		renderData["AttemptsLeft"] = attemptsLeft
+	} else if attemptsLeft == 0 {
+		renderData["Warning"] = "This is your final attempt. You will be locked out after this."
+		renderData["AttemptsLeft"] = 0
+	}
+
+	vii.Render(w, r, "admin_login.html", renderData)
+}
+
+// bannedMessage tells a banned visitor when they can try again
+func bannedMessage(until time.Time) string {
+	return "Too many failed login attempts. Try again after " + until.UTC().Format("Jan 2 15:04") + " UTC."
+}
+
 // CheckLoginRateLimit is a helper to check rate limit status (for GET /login)
 func CheckLoginRateLimit(r *http.Request) (status ratelimit.LoginStatus, err error) {
 	clientIP := ratelimit.GetClientIP(r)
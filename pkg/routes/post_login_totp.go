@@ -0,0 +1,87 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/phillip-england/thispage/pkg/audit"
+	"github.com/phillip-england/thispage/pkg/auth"
+	"github.com/phillip-england/thispage/pkg/credentials"
+	"github.com/phillip-england/thispage/pkg/forms"
+	"github.com/phillip-england/thispage/pkg/keys"
+	"github.com/phillip-england/thispage/pkg/ratelimit"
+	"github.com/phillip-england/vii/vii"
+)
+
+// PostLoginTOTP is the second login step for users with two-factor login.
+// Wrong codes count against the same limit as wrong passwords.
+func PostLoginTOTP(w http.ResponseWriter, r *http.Request) {
+	clientIP := ratelimit.GetClientIP(r)
+
+	status, err := ratelimit.GetLoginStatus(clientIP)
+	if err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, "Failed to check rate limit: "+err.Error())
+		return
+	}
+
+	if status.IsBlacklisted {
+		auth.DeleteChallenge(w, r)
+		vii.Render(w, r, "admin_login.html", map[string]interface{}{
+			"Error":     bannedMessage(status.BannedUntil),
+			"IsBlocked": true,
+		})
+		return
+	}
+
+	user := auth.ChallengeUser(r)
+	if user == nil {
+		auth.DeleteChallenge(w, r)
+		vii.Render(w, r, "admin_login.html", map[string]interface{}{"Error": "Login expired, sign in again"})
+		return
+	}
+
+	validator := forms.FormAdminTOTP{}
+	data, err := validator.Validate(r)
+	if err != nil {
+		vii.Render(w, r, "admin_login.html", map[string]interface{}{"Error": "Invalid form data", "TwoFactor": true})
+		return
+	}
+
+	projectPath, ok := vii.GetContext(keys.ProjectPath, r).(string)
+	if !ok {
+		vii.WriteError(w, http.StatusInternalServerError, "Project path not found in context")
+		return
+	}
+
+	valid, err := credentials.VerifySecondFactor(projectPath, user.ID, data.Code)
+	if err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, "Failed to check code: "+err.Error())
+		return
+	}
+
+	if !valid {
+		ended, err := auth.FailChallenge(w, r)
+		if err != nil {
+			vii.WriteError(w, http.StatusInternalServerError, "Failed to record code attempt: "+err.Error())
+			return
+		}
+		if ended {
+			renderLoginFailure(w, r, clientIP, "Too many invalid codes, sign in again", nil)
+			return
+		}
+		renderLoginFailure(w, r, clientIP, "Invalid code", map[string]interface{}{"TwoFactor": true})
+		return
+	}
+
+	// Successful login - record it and clear previous failed attempts
+	ratelimit.RecordAttempt(clientIP, true)
+	ratelimit.ClearAttemptsForIP(clientIP)
+	auth.DeleteChallenge(w, r)
+
+	if err := auth.CreateSession(w, r, user); err != nil {
+		vii.WriteError(w, http.StatusInternalServerError, "Failed to create session: "+err.Error())
+		return
+	}
+	audit.RecordAs(r, user.Username, audit.Login, "")
+
+	vii.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
@@ -0,0 +1,35 @@
+package routes
+
+import (
+	"net/http"
+	"path/filepath"
+
+	"github.com/phillip-england/thispage/pkg/keys"
+	"github.com/phillip-england/vii/vii"
+)
+
+// PutAPIFileContent creates or overwrites the text file named by the path
+// query parameter with the content of a JSON body
+func PutAPIFileContent(w http.ResponseWriter, r *http.Request) {
+	projectPath, ok := vii.GetContext(keys.ProjectPath, r).(string)
+	if !ok {
+		vii.WriteError(w, http.StatusInternalServerError, "Project path not found in context")
+		return
+	}
+
+	var body struct {
+		Content string `json:"content"`
+	}
+	if err := vii.ReadJSON(r, &body); err != nil {
+		vii.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	relPath, ferr := saveFile(r, projectPath, r.URL.Query().Get("path"), body.Content)
+	if ferr != nil {
+		vii.WriteError(w, ferr.status, ferr.message)
+		return
+	}
+
+	vii.WriteJSON(w, http.StatusOK, map[string]string{"path": filepath.ToSlash(relPath)})
+}
@@ -0,0 +1,110 @@
+package security
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/phillip-england/thispage/pkg/config"
+)
+
+// NonceScriptTag opens the inline scripts thispage adds to pages (admin mode,
+// live reload). ApplyNonce gives them the nonce of the current response.
+const NonceScriptTag = "<script data-thispage-nonce>"
+
+// Middleware adds the headers every response gets, including the admin UI
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := config.Get().Security
+		header := w.Header()
+
+		header.Set("X-Content-Type-Options", "nosniff")
+		if cfg.ReferrerPolicy != "" {
+			header.Set("Referrer-Policy", cfg.ReferrerPolicy)
+		}
+		if cfg.HSTSMaxAgeSeconds > 0 && r.TLS != nil {
+			header.Set("Strict-Transport-Security", "max-age="+strconv.Itoa(cfg.HSTSMaxAgeSeconds)+"; includeSubDomains")
+		}
+		if cfg.FrameAncestors != "" {
+			header.Set("Content-Security-Policy", "frame-ancestors "+cfg.FrameAncestors)
+			// Older browsers only understand X-Frame-Options
+			switch strings.TrimSpace(cfg.FrameAncestors) {
+			case "'none'":
+				header.Set("X-Frame-Options", "DENY")
+			case "'self'":
+				header.Set("X-Frame-Options", "SAMEORIGIN")
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SetPagePolicy replaces the baseline header with the project's
+// Content-Security-Policy and returns the nonce the page's scripts must carry.
+// It returns "" when no policy is configured.
+func SetPagePolicy(w http.ResponseWriter) (string, error) {
+	cfg := config.Get().Security
+	if strings.TrimSpace(cfg.ContentSecurityPolicy) == "" {
+		return "", nil
+	}
+	nonce, err := newNonce()
+	if err != nil {
+		return "", err
+	}
+	w.Header().Set("Content-Security-Policy", BuildPolicy(cfg.ContentSecurityPolicy, cfg.FrameAncestors, nonce))
+	return nonce, nil
+}
+
+// BuildPolicy adds the nonce to script-src (falling back to default-src) and
+// appends frame-ancestors unless the policy already sets it
+func BuildPolicy(policy, frameAncestors, nonce string) string {
+	var directives []string
+	for _, directive := range strings.Split(policy, ";") {
+		if directive = strings.TrimSpace(directive); directive != "" {
+			directives = append(directives, directive)
+		}
+	}
+
+	nonceSource := "'nonce-" + nonce + "'"
+	target, hasFrameAncestors := -1, false
+	for i, directive := range directives {
+		switch strings.ToLower(strings.Fields(directive)[0]) {
+		case "script-src":
+			target = i
+		case "default-src":
+			if target == -1 || !strings.HasPrefix(strings.ToLower(directives[target]), "script-src") {
+				target = i
+			}
+		case "frame-ancestors":
+			hasFrameAncestors = true
+		}
+	}
+	// Without script-src or default-src, inline scripts are not restricted
+	if target != -1 {
+		directives[target] += " " + nonceSource
+	}
+	if !hasFrameAncestors && frameAncestors != "" {
+		directives = append(directives, "frame-ancestors "+frameAncestors)
+	}
+	return strings.Join(directives, "; ")
+}
+
+// ApplyNonce adds the nonce attribute to every thispage script tag in html
+func ApplyNonce(html []byte, nonce string) []byte {
+	if nonce == "" {
+		return html
+	}
+	return bytes.ReplaceAll(html, []byte(NonceScriptTag), []byte(`<script data-thispage-nonce nonce="`+nonce+`">`))
+}
+
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
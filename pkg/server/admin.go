@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/phillip-england/thispage/pkg/metrics"
+)
+
+// publicListenerKey marks requests that arrived on the public listener while
+// the admin interface has a listener of its own
+type publicListenerKey struct{}
+
+// publicContext is the BaseContext of the public listener when admin is split off
+func publicContext(net.Listener) context.Context {
+	return context.WithValue(context.Background(), publicListenerKey{}, true)
+}
+
+// hideAdmin keeps the admin interface off the public listener: admin routes
+// are not found and admin sessions are ignored, so every page is served
+// exactly as a visitor sees it
+func hideAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if public, _ := r.Context().Value(publicListenerKey{}).(bool); !public {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if isAdminPath(r.URL.Path) {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, withoutCookie(r, "session_key"))
+	})
+}
+
+// isAdminPath reports whether path belongs to the admin listener
+func isAdminPath(path string) bool {
+	return path == "/login" || strings.HasPrefix(path, "/login/") || path == "/admin" || strings.HasPrefix(path, "/admin/") || path == metrics.Path
+}
+
+// withoutCookie returns a copy of r with the named cookie dropped
+func withoutCookie(r *http.Request, name string) *http.Request {
+	if _, err := r.Cookie(name); err != nil {
+		return r
+	}
+	r = r.Clone(r.Context())
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, cookie := range cookies {
+		if cookie.Name != name {
+			r.AddCookie(cookie)
+		}
+	}
+	return r
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/phillip-england/thispage/pkg/config"
+	"github.com/phillip-england/thispage/pkg/ratelimit"
+)
+
+// requireMetricsAccess serves /metrics only to metrics.allowed_ips or to a
+// caller presenting metrics.token. Everyone else gets a 404, as if the
+// endpoint were off.
+func requireMetricsAccess(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg := config.Get().Metrics
+		if !cfg.Enabled || !metricsAllowed(cfg, r) {
+			http.NotFound(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func metricsAllowed(cfg config.MetricsConfig, r *http.Request) bool {
+	if cfg.Token != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Token)) == 1 {
+			return true
+		}
+	}
+	client, err := netip.ParseAddr(ratelimit.GetClientIP(r))
+	if err != nil {
+		return false
+	}
+	client = client.Unmap()
+	for _, prefix := range cfg.AllowedIPPrefixes() {
+		if prefix.Contains(client) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,76 +1,235 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/phillip-england/thispage/pkg/analytics"
+	"github.com/phillip-england/thispage/pkg/apitokens"
 	"github.com/phillip-england/thispage/pkg/auth"
+	"github.com/phillip-england/thispage/pkg/compress"
+	"github.com/phillip-england/thispage/pkg/config"
 	"github.com/phillip-england/thispage/pkg/credentials"
 	"github.com/phillip-england/thispage/pkg/database"
+	"github.com/phillip-england/thispage/pkg/httpcache"
 	"github.com/phillip-england/thispage/pkg/keys"
+	"github.com/phillip-england/thispage/pkg/livereload"
+	"github.com/phillip-england/thispage/pkg/logging"
+	"github.com/phillip-england/thispage/pkg/metrics"
+	"github.com/phillip-england/thispage/pkg/ratelimit"
+	"github.com/phillip-england/thispage/pkg/roles"
 	"github.com/phillip-england/thispage/pkg/routes"
+	"github.com/phillip-england/thispage/pkg/security"
 	"github.com/phillip-england/thispage/pkg/tailwind"
 	adminassets "github.com/phillip-england/thispage/static"
 	admintemplates "github.com/phillip-england/thispage/templates"
 	"github.com/phillip-england/vii/vii"
 )
 
-func Serve(projectPath string, port string) error {
-	cwd, err := os.Getwd()
+// Options controls how Serve runs the project
+type Options struct {
+	// Port overrides server.port from thispage.toml when set
+	Port string
+	// Dev enables live reload: pages get the reload script and the SSE endpoint is registered
+	Dev bool
+	// TLSCert and TLSKey override tls.cert_file and tls.key_file
+	TLSCert string
+	TLSKey  string
+	// ACMEDomains overrides tls.acme.domains
+	ACMEDomains []string
+	// RedirectPort overrides tls.redirect_port
+	RedirectPort string
+	// AdminAddress overrides server.admin_address
+	AdminAddress string
+}
+
+// Serve runs the project until ctx is cancelled, then drains in-flight
+// requests and releases the database and the Tailwind watch process.
+func Serve(ctx context.Context, projectPath string, opts Options) error {
+	// Abs keeps absolute paths intact (the sites supervisor passes them)
+	absProjectPath, err := filepath.Abs(projectPath)
 	if err != nil {
 		return err
 	}
 
-	absProjectPath := filepath.Join(cwd, projectPath)
-	liveDirPath := filepath.Join(absProjectPath, "live")
+	// Load thispage.toml (and .env overrides)
+	cfg, err := config.Load(absProjectPath)
+	if err != nil {
+		return err
+	}
+	// Command line flags win over the file and environment
+	if opts.Port != "" {
+		cfg.Server.Port = opts.Port
+	}
+	if opts.TLSCert != "" || opts.TLSKey != "" {
+		cfg.TLS.CertFile, cfg.TLS.KeyFile = opts.TLSCert, opts.TLSKey
+	}
+	if len(opts.ACMEDomains) > 0 {
+		cfg.TLS.ACME.Domains = opts.ACMEDomains
+	}
+	if opts.RedirectPort != "" {
+		cfg.TLS.RedirectPort = opts.RedirectPort
+	}
+	if opts.AdminAddress != "" {
+		cfg.Server.AdminAddress = opts.AdminAddress
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	config.Set(cfg)
 
-	// Load .env
-	_ = godotenv.Load(filepath.Join(absProjectPath, ".env"))
+	liveDirPath := filepath.Join(absProjectPath, cfg.Build.OutputDir)
 
 	if _, err := credentials.EnsureProjectSeed(absProjectPath); err != nil {
 		return fmt.Errorf("failed to initialize project seed: %w", err)
 	}
 
     // Init Database
-    if err := database.Init(absProjectPath); err != nil {
+    if err := database.Init(absProjectPath, cfg.Database.BanMinutes); err != nil {
         return fmt.Errorf("failed to init database: %w", err)
     }
+	defer database.Close()
+
+	limiter := ratelimit.NewLimiter()
+	if cfg.RateLimit.Persist {
+		if err := limiter.Load(); err != nil {
+			slog.Warn("failed to load rate limit buckets", "error", err)
+		}
+		defer func() {
+			if err := limiter.Save(); err != nil {
+				slog.Warn("failed to save rate limit buckets", "error", err)
+			}
+		}()
+	}
 
     // Ensure Tailwind CSS is installed and start watch process
+    tailwindEnabled := true
     if err := tailwind.StartWatch(absProjectPath); err != nil {
-        fmt.Printf("WARNING: Failed to start Tailwind CSS: %v\n", err)
-        fmt.Println("CSS compilation will not be available.")
+        slog.Warn("failed to start Tailwind CSS, CSS compilation will not be available", "error", err)
+        tailwindEnabled = false
     }
+	defer tailwind.StopWatch()
 	
 	app := vii.NewApp()
 	app.SetContext(keys.ProjectPath, absProjectPath)
+	app.SetContext(keys.TailwindEnabled, tailwindEnabled)
 	
 	if err := app.LoadTemplatesFS(admintemplates.AdminFS, nil); err != nil {
 		return err
 	}
 
-	app.Use(vii.Logger)
+	app.Use(logging.Middleware)
+	app.Use(metrics.Middleware(app.Mux))
+	app.Use(hideAdmin)
+	app.Use(security.Middleware)
+	app.Use(limiter.Middleware)
+	// Compresses whatever was not served from a precompressed variant
+	app.Use(compress.Middleware)
 	
+	etags := httpcache.NewETags(absProjectPath, liveDirPath)
+
 	// Serve User Project Static Files
-	app.ServeDir("/static", filepath.Join(absProjectPath, "static"))
+	staticDirPath := filepath.Join(absProjectPath, "static")
+	app.Handle("GET /static/", func(w http.ResponseWriter, r *http.Request) {
+		relPath := strings.TrimPrefix(r.URL.Path, "/static/")
+		fsPath := filepath.Join(staticDirPath, filepath.FromSlash(relPath))
+		if !strings.HasPrefix(fsPath, staticDirPath+string(filepath.Separator)) {
+			http.NotFound(w, r)
+			return
+		}
+		info, err := os.Stat(fsPath)
+		if err != nil || info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+		if opts.Dev || auth.IsAuthenticated(r) {
+			httpcache.Bypass(w, r)
+			http.ServeFile(w, r, fsPath)
+			return
+		}
+		// compiler.Build mirrors precompressed static assets into the output dir
+		etags.ServeFile(w, r, cfg.Cache.Rules, fsPath, filepath.Join(liveDirPath, "static", filepath.FromSlash(relPath)))
+	})
 	
 	// Serve Admin Interface Static Files (embedded)
 	app.ServeFS("/admin/assets", adminassets.AdminFS)
 
+	// Live reload events for dev mode
+	if opts.Dev {
+		app.Handle("GET "+livereload.Path, livereload.Default.ServeHTTP)
+	}
+
+	servePage := func(w http.ResponseWriter, r *http.Request, path string, isAdmin bool) {
+		// Shared caches must not hand one visitor's page to an admin
+		w.Header().Add("Vary", "Cookie")
+		if isAdmin {
+			httpcache.Bypass(w, r)
+		}
+		isHTML := filepath.Ext(path) == ".html"
+		if isHTML && !isAdmin && r.Method == http.MethodGet {
+			if err := analytics.Record(r); err != nil {
+				logging.FromRequest(r).Warn("failed to record page view", "error", err)
+			}
+		}
+		var nonce string
+		if isHTML {
+			var err error
+			nonce, err = security.SetPagePolicy(w)
+			if err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+		if !isHTML || (!opts.Dev && nonce == "") {
+			if isAdmin {
+				http.ServeFile(w, r, path)
+			} else {
+				etags.ServeFile(w, r, cfg.Cache.Rules, path, path)
+			}
+			return
+		}
+
+		// The page is rewritten per request, so it has no stable ETag
+		content, err := os.ReadFile(path)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if opts.Dev {
+			content = livereload.Inject(content)
+			w.Header().Set("Cache-Control", "no-store")
+		} else if !isAdmin {
+			if cacheControl := httpcache.CacheControlFor(cfg.Cache.Rules, r.URL.Path); cacheControl != "" {
+				w.Header().Set("Cache-Control", cacheControl)
+			}
+		}
+		content = security.ApplyNonce(content, nonce)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		http.ServeContent(w, r, filepath.Base(path), time.Time{}, bytes.NewReader(content))
+	}
+
     // Custom handler for live directory to support clean URLs (extensionless .html)
     app.Handle("GET /", func(w http.ResponseWriter, r *http.Request) {
         isAdminParam := r.URL.Query().Get("is_admin") == "true"
 
         // Use refresh version when in admin mode to extend session
-        var isAuthenticated bool
+        var user *credentials.User
         if isAdminParam {
-            isAuthenticated = auth.IsAuthenticatedAndRefresh(w, r)
+            user, r = auth.AuthenticateAndRefresh(w, r)
         } else {
-            isAuthenticated = auth.IsAuthenticated(r)
+            user = auth.Authenticate(r)
         }
+        // Only roles that edit content get the in-page editor
+        isAuthenticated := user != nil && roles.Can(user.Role, roles.EditContent)
 
         // If trying to access admin mode but not authenticated, strip param
         if isAdminParam && !isAuthenticated {
@@ -102,7 +261,7 @@ func Serve(projectPath string, port string) error {
                 // If directory, try index.html
                 indexPath := filepath.Join(fsPath, "index.html")
                 if _, err := os.Stat(indexPath); err == nil {
-                    http.ServeFile(w, r, indexPath)
+                    servePage(w, r, indexPath, isAuthenticated)
                     return
                 }
                 // If no index.html, 404 or list dir (let's 404 for security)
@@ -110,14 +269,14 @@ func Serve(projectPath string, port string) error {
                 return
             }
             // It's a file, serve it
-            http.ServeFile(w, r, fsPath)
+            servePage(w, r, fsPath, isAuthenticated)
             return
         }
 
         // 2. Check if path + .html exists
         htmlPath := fsPath + ".html"
         if _, err := os.Stat(htmlPath); err == nil {
-            http.ServeFile(w, r, htmlPath)
+            servePage(w, r, htmlPath, isAuthenticated)
             return
         }
 
@@ -125,41 +284,226 @@ func Serve(projectPath string, port string) error {
         http.NotFound(w, r)
     })
 
-    authMiddleware := func(next http.HandlerFunc) http.HandlerFunc {
+    // requireUser sends visitors to the login page and hands the signed-in
+    // user to the route. Anything but a GET must also carry the session's
+    // CSRF token, so other sites cannot post to the admin as the user.
+    requireUser := func(next http.HandlerFunc) http.HandlerFunc {
         return func(w http.ResponseWriter, r *http.Request) {
-            if !auth.IsAuthenticatedAndRefresh(w, r) {
+            user, r := auth.AuthenticateAndRefresh(w, r)
+            if user == nil {
                 http.Redirect(w, r, "/login", http.StatusSeeOther)
                 return
             }
+            if r.Method != http.MethodGet && r.Method != http.MethodHead && !auth.ValidCSRF(r) {
+                vii.WriteError(w, http.StatusForbidden, "Invalid or missing CSRF token, reload the page and try again")
+                return
+            }
+            next(w, r)
+        }
+    }
+
+    // limitBody caps an upload before the CSRF check reads the form
+    limitBody := func(megabytes func() int, next http.HandlerFunc) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+            limit := int64(megabytes()) << 20
+            if r.ContentLength > limit {
+                vii.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Upload is larger than %d MB", megabytes()))
+                return
+            }
+            r.Body = http.MaxBytesReader(w, r.Body, limit)
+            next(w, r)
+        }
+    }
+    maxFileSize := func() int { return config.Get().Uploads.MaxFileSizeMB }
+    maxZipSize := func() int { return config.Get().Uploads.MaxZipSizeMB }
+
+    // requirePermission additionally checks the user's role
+    requirePermission := func(permission roles.Permission, next http.HandlerFunc) http.HandlerFunc {
+        return requireUser(func(w http.ResponseWriter, r *http.Request) {
+            if !roles.Can(auth.CurrentUser(r).Role, permission) {
+                vii.WriteError(w, http.StatusForbidden, "Your role does not allow this")
+                return
+            }
             next(w, r)
+        })
+    }
+
+    // requireToken serves the JSON API to callers with an API token that has
+    // scope, as long as the token's user still has a role that allows it.
+    // Bearer tokens are never sent by a browser on its own, so there is no
+    // CSRF check.
+    requireToken := func(scope string, next http.HandlerFunc) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+            token, user := apitokens.Authenticate(r)
+            if token == nil {
+                w.Header().Set("WWW-Authenticate", `Bearer realm="thispage"`)
+                vii.WriteError(w, http.StatusUnauthorized, "Missing or invalid API token")
+                return
+            }
+            if !token.Has(scope) || !apitokens.Allowed(user.Role, scope) {
+                vii.WriteError(w, http.StatusForbidden, "Token does not allow "+scope)
+                return
+            }
+            next(w, auth.WithUser(r, user))
         }
     }
 
 	app.Handle("GET /login", routes.GetLogin)
 	app.Handle("POST /login", routes.PostLogin)
+	app.Handle("POST /login/totp", routes.PostLoginTOTP)
 	app.Handle("GET /contact", routes.GetContact)
 	app.Handle("POST /contact", routes.PostContact)
-	app.Handle("GET /admin", authMiddleware(routes.GetAdminFiles))
-	app.Handle("GET /admin/files/view", authMiddleware(routes.GetAdminFileView))
-	app.Handle("POST /admin/files/save", authMiddleware(routes.PostAdminFileSave))
-	app.Handle("POST /admin/files/upload", authMiddleware(routes.PostAdminFileUpload))
-	app.Handle("POST /admin/files/delete", authMiddleware(routes.PostAdminFileDelete))
-	app.Handle("POST /admin/files/rename", authMiddleware(routes.PostAdminFileRename))
-	app.Handle("POST /admin/files/create", authMiddleware(routes.PostAdminFileCreate))
-	app.Handle("POST /admin/files/create-dir", authMiddleware(routes.PostAdminDirCreate))
-	app.Handle("POST /admin/files/zip-upload", authMiddleware(routes.PostAdminZipUpload))
-	app.Handle("GET /admin/export", authMiddleware(routes.GetAdminExport))
-	app.Handle("GET /admin/messages", authMiddleware(routes.GetAdminMessages))
-	app.Handle("GET /admin/messages/view", authMiddleware(routes.GetAdminMessageView))
-	app.Handle("POST /admin/messages/delete", authMiddleware(routes.PostAdminMessageDelete))
+	app.Handle("GET /admin", requireUser(routes.GetAdminFiles))
+	app.Handle("GET /admin/account", requireUser(routes.GetAdminAccount))
+	app.Handle("POST /admin/account/2fa/enable", requireUser(routes.PostAdminTOTPEnable))
+	app.Handle("POST /admin/account/2fa/disable", requireUser(routes.PostAdminTOTPDisable))
+	app.Handle("GET /admin/sessions", requireUser(routes.GetAdminSessions))
+	app.Handle("POST /admin/sessions/revoke", requireUser(routes.PostAdminSessionRevoke))
+	app.Handle("POST /admin/sessions/revoke-all", requireUser(routes.PostAdminSessionsRevokeAll))
+	app.Handle("GET /admin/tokens", requireUser(routes.GetAdminTokens))
+	app.Handle("POST /admin/tokens/create", requireUser(routes.PostAdminTokenCreate))
+	app.Handle("POST /admin/tokens/revoke", requireUser(routes.PostAdminTokenRevoke))
+	app.Handle("GET /admin/files/view", requirePermission(roles.EditContent, routes.GetAdminFileView))
+	app.Handle("POST /admin/files/save", requirePermission(roles.EditContent, routes.PostAdminFileSave))
+	app.Handle("POST /admin/files/upload", limitBody(maxFileSize, requirePermission(roles.EditContent, routes.PostAdminFileUpload)))
+	app.Handle("POST /admin/files/delete", requirePermission(roles.EditContent, routes.PostAdminFileDelete))
+	app.Handle("POST /admin/files/rename", requirePermission(roles.EditContent, routes.PostAdminFileRename))
+	app.Handle("POST /admin/files/create", requirePermission(roles.EditContent, routes.PostAdminFileCreate))
+	app.Handle("POST /admin/files/create-dir", requirePermission(roles.EditContent, routes.PostAdminDirCreate))
+	app.Handle("POST /admin/files/zip-upload", limitBody(maxZipSize, requirePermission(roles.ManageProject, routes.PostAdminZipUpload)))
+	app.Handle("GET /admin/export", requirePermission(roles.ManageProject, routes.GetAdminExport))
+	app.Handle("GET /admin/bans", requirePermission(roles.ManageProject, routes.GetAdminBans))
+	app.Handle("POST /admin/bans/delete", requirePermission(roles.ManageProject, routes.PostAdminBanDelete))
+	app.Handle("GET /admin/audit", requirePermission(roles.ViewAudit, routes.GetAdminAudit))
+	app.Handle("GET /admin/audit/export", requirePermission(roles.ViewAudit, routes.GetAdminAuditExport))
+	app.Handle("GET /admin/messages", requirePermission(roles.ReadMessages, routes.GetAdminMessages))
+	app.Handle("GET /admin/analytics", requirePermission(roles.ViewAnalytics, routes.GetAdminAnalytics))
+	app.Handle("GET /admin/messages/view", requirePermission(roles.ReadMessages, routes.GetAdminMessageView))
+	app.Handle("POST /admin/messages/delete", requirePermission(roles.DeleteMessages, routes.PostAdminMessageDelete))
 
     // API Routes
-    app.Handle("GET /admin/api/components", authMiddleware(routes.GetAdminComponents))
+    app.Handle("GET /admin/api/components", requirePermission(roles.EditContent, routes.GetAdminComponents))
     
+	// Versioned JSON API for scripts and CI, authenticated with API tokens
+	app.Handle("GET /admin/api/v1/files", requireToken(apitokens.FilesRead, routes.GetAPIFiles))
+	app.Handle("GET /admin/api/v1/files/content", requireToken(apitokens.FilesRead, routes.GetAPIFileContent))
+	app.Handle("PUT /admin/api/v1/files/content", requireToken(apitokens.FilesWrite, routes.PutAPIFileContent))
+	app.Handle("POST /admin/api/v1/files/rename", requireToken(apitokens.FilesWrite, routes.PostAPIFileRename))
+	app.Handle("DELETE /admin/api/v1/files", requireToken(apitokens.FilesWrite, routes.DeleteAPIFile))
+	app.Handle("POST /admin/api/v1/build", requireToken(apitokens.Build, routes.PostAPIBuild))
+	app.Handle("GET /admin/api/v1/messages", requireToken(apitokens.MessagesRead, routes.GetAPIMessages))
+	app.Handle("GET /admin/api/v1/export", requireToken(apitokens.Export, routes.GetAdminExport))
+
 	app.Handle("GET /admin/logout", routes.GetAdminLogout)
 
-	if port == "" {
-		port = "8080"
+	// Probes for load balancers and monitoring
+	app.Handle("GET /healthz", routes.GetHealthz)
+	app.Handle("GET /readyz", routes.GetReadyz)
+	app.Handle("GET "+metrics.Path, requireMetricsAccess(metrics.Handler))
+	metrics.RegisterGauge("thispage_blacklist_entries", "IP addresses currently on the login blacklist.", func() (float64, error) {
+		count, err := ratelimit.BlacklistSize()
+		return float64(count), err
+	})
+
+	port := cfg.Server.Port
+
+	srv := &http.Server{
+		Addr:    net.JoinHostPort(cfg.Server.BindAddress, port),
+		Handler: app,
+	}
+	// Event streams never finish on their own, end them so Shutdown can drain
+	srv.RegisterOnShutdown(livereload.Default.Close)
+
+	// The admin interface gets its own plain HTTP listener, meant for
+	// localhost or a private network, and disappears from the public one
+	var adminSrv *http.Server
+	if cfg.Server.AdminAddress != "" {
+		srv.BaseContext = publicContext
+		adminSrv = &http.Server{
+			Addr:    cfg.Server.AdminAddress,
+			Handler: app,
+		}
+		adminSrv.RegisterOnShutdown(livereload.Default.Close)
+	}
+
+	var redirect http.Handler = redirectToHTTPS(port)
+	if len(cfg.TLS.ACME.Domains) > 0 {
+		manager, err := newACMEManager(absProjectPath, cfg.TLS.ACME)
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig = manager.TLSConfig()
+		// Answers http-01 challenges, redirects everything else
+		redirect = manager.HTTPHandler(redirect)
+	}
+
+	serveErr := make(chan error, 3)
+	go func() {
+		switch {
+		case cfg.TLS.CertFile != "":
+			slog.Info("starting server 🚀", "port", port, "tls", "files")
+			serveErr <- srv.ListenAndServeTLS(projectFile(absProjectPath, cfg.TLS.CertFile), projectFile(absProjectPath, cfg.TLS.KeyFile))
+		case len(cfg.TLS.ACME.Domains) > 0:
+			slog.Info("starting server 🚀", "port", port, "tls", "acme", "domains", cfg.TLS.ACME.Domains)
+			serveErr <- srv.ListenAndServeTLS("", "")
+		default:
+			slog.Info("starting server 🚀", "port", port)
+			serveErr <- srv.ListenAndServe()
+		}
+	}()
+
+	var redirectSrv *http.Server
+	if cfg.TLS.RedirectPort != "" {
+		redirectSrv = &http.Server{
+			Addr:    net.JoinHostPort(cfg.Server.BindAddress, cfg.TLS.RedirectPort),
+			Handler: redirect,
+		}
+		go func() {
+			slog.Info("redirecting http to https", "port", cfg.TLS.RedirectPort)
+			if err := redirectSrv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				serveErr <- err
+			}
+		}()
+	}
+
+	if adminSrv != nil {
+		go func() {
+			slog.Info("serving admin interface", "address", cfg.Server.AdminAddress)
+			if err := adminSrv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				serveErr <- err
+			}
+		}()
+	}
+
+	select {
+	case err := <-serveErr:
+		if redirectSrv != nil {
+			redirectSrv.Close()
+		}
+		if adminSrv != nil {
+			adminSrv.Close()
+		}
+		srv.Close()
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down, draining in-flight requests")
+	timeout := time.Duration(cfg.Server.ShutdownTimeoutSeconds) * time.Second
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if redirectSrv != nil {
+		redirectSrv.Shutdown(shutdownCtx)
+	}
+	if adminSrv != nil {
+		adminSrv.Shutdown(shutdownCtx)
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		srv.Close()
+		return fmt.Errorf("graceful shutdown failed: %w", err)
 	}
-	return app.Serve(port)
+	return nil
 }
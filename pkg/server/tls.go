@@ -0,0 +1,74 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/phillip-england/thispage/pkg/config"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// newACMEManager obtains and renews certificates for the configured domains,
+// caching them on disk so restarts do not hit the CA's rate limits
+func newACMEManager(projectPath string, cfg config.ACMEConfig) (*autocert.Manager, error) {
+	client := &acme.Client{DirectoryURL: cfg.DirectoryURL}
+	if cfg.CAFile != "" {
+		caPEM, err := os.ReadFile(projectFile(projectPath, cfg.CAFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tls.acme.ca_file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("tls.acme.ca_file contains no PEM certificates")
+		}
+		client.HTTPClient = &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+			},
+		}
+	}
+
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(cfg.Domains...),
+		Cache:      autocert.DirCache(projectFile(projectPath, cfg.CacheDir)),
+		Email:      cfg.Email,
+		Client:     client,
+	}, nil
+}
+
+// redirectToHTTPS sends plain HTTP requests to the same URL on the TLS port
+func redirectToHTTPS(tlsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+		if tlsPort != "443" {
+			host = net.JoinHostPort(host, tlsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// projectFile resolves a configured path relative to the project
+func projectFile(projectPath, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(projectPath, path)
+}
@@ -0,0 +1,557 @@
+package sites
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/netip"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/fsnotify/fsnotify"
+	"github.com/joho/godotenv"
+	"github.com/phillip-england/thispage/pkg/config"
+	"github.com/phillip-england/thispage/pkg/process"
+)
+
+// Each site runs as its own `thispage serve` child process bound to loopback,
+// so projects keep separate databases, credentials, config and Tailwind
+// watchers. The supervisor proxies requests to them by Host header.
+
+// stopTimeout bounds how long a child may take to drain before it is killed
+const stopTimeout = 20 * time.Second
+
+// maxRestartDelay caps the backoff between restarts of a crashing site
+const maxRestartDelay = 30 * time.Second
+
+// Site is one project and the host names that route to it
+type Site struct {
+	Hosts []string `toml:"hosts"`
+	Path  string   `toml:"path"`
+}
+
+type file struct {
+	Sites []Site `toml:"site"`
+}
+
+// Load reads a sites file such as:
+//
+//	[[site]]
+//	hosts = ["example.com", "www.example.com"]
+//	path = "/srv/example"
+//
+// Relative paths are resolved against the directory of the sites file.
+func Load(path string) ([]Site, error) {
+	var f file
+	meta, err := toml.DecodeFile(path, &f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, key := range undecoded {
+			keys[i] = key.String()
+		}
+		return nil, fmt.Errorf("unknown keys in %s: %s", path, strings.Join(keys, ", "))
+	}
+
+	baseDir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+
+	seenHosts := map[string]string{}
+	seenPaths := map[string]bool{}
+	for i := range f.Sites {
+		site := &f.Sites[i]
+		if site.Path == "" {
+			return nil, fmt.Errorf("site %d has no path", i+1)
+		}
+		if !filepath.IsAbs(site.Path) {
+			site.Path = filepath.Join(baseDir, site.Path)
+		}
+		site.Path = filepath.Clean(site.Path)
+		if info, err := os.Stat(site.Path); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("site %d: %s is not a directory", i+1, site.Path)
+		}
+		if seenPaths[site.Path] {
+			return nil, fmt.Errorf("site %d: %s is listed twice", i+1, site.Path)
+		}
+		seenPaths[site.Path] = true
+		if err := checkPlainHTTP(site.Path); err != nil {
+			return nil, fmt.Errorf("site %d (%s): %w", i+1, site.Path, err)
+		}
+
+		if len(site.Hosts) == 0 {
+			return nil, fmt.Errorf("site %d (%s) has no hosts", i+1, site.Path)
+		}
+		for j, host := range site.Hosts {
+			host = normalizeHost(host)
+			if host == "" || strings.ContainsAny(host, "/ ") {
+				return nil, fmt.Errorf("site %d (%s) has an invalid host %q", i+1, site.Path, site.Hosts[j])
+			}
+			if other, ok := seenHosts[host]; ok {
+				return nil, fmt.Errorf("host %s is claimed by both %s and %s", host, other, site.Path)
+			}
+			seenHosts[host] = site.Path
+			site.Hosts[j] = host
+		}
+	}
+	return f.Sites, nil
+}
+
+// tlsEnv lists the environment variables that turn on HTTPS or the redirect listener
+var tlsEnv = []string{"THISPAGE_TLS_CERT_FILE", "THISPAGE_TLS_KEY_FILE", "THISPAGE_TLS_REDIRECT_PORT", "THISPAGE_ACME_DOMAINS"}
+
+// checkPlainHTTP rejects projects that would serve HTTPS or a redirect port
+// themselves: the supervisor proxies and health checks every site over plain
+// HTTP on loopback, and the sites cannot all share one redirect port
+func checkPlainHTTP(projectPath string) error {
+	var f struct {
+		TLS config.TLSConfig `toml:"tls"`
+	}
+	if _, err := toml.DecodeFile(config.Path(projectPath), &f); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to parse %s: %w", config.FileName, err)
+	}
+	if f.TLS.Enabled() || f.TLS.RedirectPort != "" {
+		return fmt.Errorf("%s enables [tls], which sites cannot use; terminate TLS in front of the supervisor instead", config.FileName)
+	}
+
+	dotenv, _ := godotenv.Read(filepath.Join(projectPath, ".env"))
+	for _, name := range tlsEnv {
+		if os.Getenv(name) != "" || dotenv[name] != "" {
+			return fmt.Errorf("%s is set, which sites cannot use; terminate TLS in front of the supervisor instead", name)
+		}
+	}
+	return nil
+}
+
+// Supervisor runs one child server per site and routes requests to them
+type Supervisor struct {
+	executable string
+	// trustedProxies front the supervisor; their forwarding headers are
+	// passed on to the sites, which trust them as well
+	trustedProxies []netip.Prefix
+
+	mu       sync.RWMutex
+	children map[string]*child // by project path
+	hosts    map[string]*child
+}
+
+// child is a supervised `thispage serve` process
+type child struct {
+	path  string
+	proxy *httputil.ReverseProxy
+	ready atomic.Bool
+	stop  chan struct{} // closed to ask the child to shut down
+	done  chan struct{} // closed once the child has exited for good
+
+	mu   sync.Mutex
+	port string // a new one on every restart
+}
+
+// NewSupervisor creates a supervisor that launches children from the
+// running binary. trustedProxies lists the CIDRs (or single IPs) of reverse
+// proxies in front of the supervisor.
+func NewSupervisor(trustedProxies []string) (*Supervisor, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate thispage executable: %w", err)
+	}
+	prefixes := make([]netip.Prefix, 0, len(trustedProxies))
+	for _, entry := range trustedProxies {
+		prefix, err := parsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q is not an IP address or CIDR", entry)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return &Supervisor{
+		executable:     executable,
+		trustedProxies: prefixes,
+		children:       make(map[string]*child),
+		hosts:          make(map[string]*child),
+	}, nil
+}
+
+// Apply starts sites that are new, stops sites that were removed and
+// updates host routing for the rest, without touching unchanged children
+func (s *Supervisor) Apply(sites []Site) error {
+	s.mu.Lock()
+	wanted := make(map[string]bool, len(sites))
+	for _, site := range sites {
+		wanted[site.Path] = true
+	}
+
+	var removed []*child
+	for path, c := range s.children {
+		if !wanted[path] {
+			removed = append(removed, c)
+			delete(s.children, path)
+		}
+	}
+
+	hosts := make(map[string]*child)
+	var startErr error
+	for _, site := range sites {
+		c, ok := s.children[site.Path]
+		if !ok {
+			var err error
+			c, err = s.start(site.Path)
+			if err != nil {
+				startErr = err
+				continue
+			}
+			s.children[site.Path] = c
+		}
+		for _, host := range site.Hosts {
+			hosts[host] = c
+		}
+	}
+	s.hosts = hosts
+	s.mu.Unlock()
+
+	for _, c := range removed {
+		slog.Info("stopping site", "path", c.path)
+		c.shutdown()
+	}
+	return startErr
+}
+
+// ServeHTTP proxies the request to the site that owns its Host
+func (s *Supervisor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	c := s.hosts[normalizeHost(r.Host)]
+	s.mu.RUnlock()
+
+	if c == nil {
+		http.Error(w, "Unknown site", http.StatusNotFound)
+		return
+	}
+	if !c.ready.Load() {
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "Site is starting, try again shortly", http.StatusServiceUnavailable)
+		return
+	}
+	c.proxy.ServeHTTP(w, r)
+}
+
+// Close stops every site and waits for them to exit
+func (s *Supervisor) Close() {
+	s.mu.Lock()
+	children := make([]*child, 0, len(s.children))
+	for _, c := range s.children {
+		children = append(children, c)
+	}
+	s.children = make(map[string]*child)
+	s.hosts = make(map[string]*child)
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, c := range children {
+		wg.Add(1)
+		go func(c *child) {
+			defer wg.Done()
+			c.shutdown()
+		}(c)
+	}
+	wg.Wait()
+}
+
+// Watch re-applies the sites file whenever it changes. An invalid file is
+// reported and ignored so a typo never takes running sites down.
+func (s *Supervisor) Watch(path string) (io.Closer, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watcher: %w", err)
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	// Editors often replace the file, so watch its directory
+	if err := watcher.Add(filepath.Dir(absPath)); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("failed to watch %s: %w", path, err)
+	}
+
+	go func() {
+		debounce := time.NewTimer(time.Hour)
+		debounce.Stop()
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) == absPath && event.Op != fsnotify.Chmod {
+					debounce.Reset(200 * time.Millisecond)
+				}
+			case <-debounce.C:
+				s.Reload(absPath)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Error("sites watcher error", "error", err)
+			}
+		}
+	}()
+	return watcher, nil
+}
+
+// Reload loads the sites file and applies it
+func (s *Supervisor) Reload(path string) {
+	sites, err := Load(path)
+	if err != nil {
+		slog.Error("not reloading sites", "error", err)
+		return
+	}
+	if err := s.Apply(sites); err != nil {
+		slog.Error("failed to start site", "error", err)
+	}
+	slog.Info("sites reloaded", "count", len(sites))
+}
+
+// start launches the child for a project on a free loopback port
+func (s *Supervisor) start(path string) (*child, error) {
+	port, err := freePort()
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate a port for %s: %w", path, err)
+	}
+	c := &child{
+		path: path,
+		port: port,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	c.proxy = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(&url.URL{Scheme: "http", Host: net.JoinHostPort("127.0.0.1", c.currentPort())})
+			// The chain reported by a trusted front proxy is kept, so the
+			// site can walk it back to the real client
+			trusted := s.fromTrustedProxy(pr.In)
+			if trusted {
+				for _, name := range []string{"Forwarded", "X-Forwarded-For"} {
+					if values := pr.In.Header.Values(name); len(values) > 0 {
+						pr.Out.Header[name] = values
+					}
+				}
+			}
+			pr.SetXForwarded()
+			if proto := pr.In.Header.Get("X-Forwarded-Proto"); trusted && proto != "" {
+				pr.Out.Header.Set("X-Forwarded-Proto", proto)
+			}
+			// Sites see the public host name, not the loopback address
+			pr.Out.Host = pr.In.Host
+		},
+	}
+	slog.Info("starting site", "path", path, "port", port)
+	go c.run(s.executable, s.childTrustedProxies())
+	return c, nil
+}
+
+// fromTrustedProxy reports whether r came directly from one of trustedProxies
+func (s *Supervisor) fromTrustedProxy(r *http.Request) bool {
+	remote, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	for _, prefix := range s.trustedProxies {
+		if prefix.Contains(remote.Addr().Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// childTrustedProxies is the trusted_proxies of every site: the supervisor
+// on loopback plus the proxies the supervisor itself trusts
+func (s *Supervisor) childTrustedProxies() string {
+	entries := []string{"127.0.0.1", "::1"}
+	for _, prefix := range s.trustedProxies {
+		entries = append(entries, prefix.String())
+	}
+	return strings.Join(entries, ",")
+}
+
+// run keeps the child process alive, restarting it with backoff if it dies
+func (c *child) run(executable, trustedProxies string) {
+	defer close(c.done)
+	delay := time.Second
+	prefix := "[" + filepath.Base(c.path) + "] "
+
+	for {
+		port := c.currentPort()
+		cmd := exec.Command(executable, "serve", c.path, "--port", port)
+		cmd.Env = append(os.Environ(),
+			"THISPAGE_BIND_ADDRESS=127.0.0.1",
+			// Only the supervisor can reach the child, so its forwarding headers are trustworthy
+			"THISPAGE_TRUSTED_PROXIES="+trustedProxies,
+		)
+		cmd.Stdout = &prefixWriter{prefix: prefix, out: os.Stdout}
+		cmd.Stderr = &prefixWriter{prefix: prefix, out: os.Stderr}
+		cmd.SysProcAttr = process.ChildAttr()
+
+		started := time.Now()
+		if err := cmd.Start(); err != nil {
+			slog.Error("failed to start site", "path", c.path, "error", err)
+		} else {
+			exited := make(chan error, 1)
+			go func() { exited <- cmd.Wait() }()
+			stopProbe := make(chan struct{})
+			go c.waitReady(stopProbe, port)
+
+			select {
+			case err := <-exited:
+				close(stopProbe)
+				c.ready.Store(false)
+				slog.Warn("site exited", "path", c.path, "error", err)
+			case <-c.stop:
+				close(stopProbe)
+				c.ready.Store(false)
+				process.Interrupt(cmd.Process)
+				select {
+				case <-exited:
+				case <-time.After(stopTimeout):
+					cmd.Process.Kill()
+					<-exited
+				}
+				return
+			}
+		}
+
+		// A site that ran for a while gets a fresh backoff
+		if time.Since(started) > time.Minute {
+			delay = time.Second
+		}
+		select {
+		case <-c.stop:
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRestartDelay)
+
+		// The old port was free while the site was down and may have been
+		// taken since, so the restart gets a new one
+		if port, err := freePort(); err != nil {
+			slog.Error("failed to allocate a port for site", "path", c.path, "error", err)
+		} else {
+			c.mu.Lock()
+			c.port = port
+			c.mu.Unlock()
+		}
+	}
+}
+
+// currentPort is the port the child listens on, or will once it has restarted
+func (c *child) currentPort() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.port
+}
+
+// waitReady marks the child ready once its /healthz on port answers
+func (c *child) waitReady(stop <-chan struct{}, port string) {
+	client := &http.Client{Timeout: time.Second}
+	url := "http://" + net.JoinHostPort("127.0.0.1", port) + "/healthz"
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		resp, err := client.Get(url)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			c.ready.Store(true)
+			slog.Info("site ready", "path", c.path, "port", port)
+			return
+		}
+	}
+}
+
+// shutdown stops the child and waits for it to exit
+func (c *child) shutdown() {
+	close(c.stop)
+	<-c.done
+}
+
+// freePort asks the kernel for an unused loopback port
+func freePort() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer listener.Close()
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	return port, err
+}
+
+// parsePrefix accepts a CIDR or a bare IP address
+func parsePrefix(entry string) (netip.Prefix, error) {
+	entry = strings.TrimSpace(entry)
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+}
+
+// normalizeHost lowercases a Host header and strips the port and trailing dot
+func normalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+}
+
+// prefixWriter labels each line of a child's output with its site
+type prefixWriter struct {
+	prefix string
+	out    io.Writer
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if _, err := fmt.Fprintf(p.out, "%s%s", p.prefix, p.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
@@ -3,6 +3,7 @@ package tailwind
 import (
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/exec"
@@ -10,16 +11,23 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/phillip-england/thispage/pkg/process"
 )
 
 // Global process management
 var (
 	watchCmd     *exec.Cmd
+	watchDone    chan struct{}
 	watchMutex   sync.Mutex
 	projectPath  string
 	tailwindPath string
 )
 
+// stopTimeout is how long the watch process gets to exit before it is killed
+const stopTimeout = 3 * time.Second
+
 // Version is the Tailwind CSS version to install
 // Update this constant to upgrade Tailwind for all thispage projects
 const Version = "4.1.18"
@@ -163,7 +171,7 @@ func Download() error {
 	}
 
 	downloadURL := fmt.Sprintf(BaseURL, Version, binaryName)
-	fmt.Printf("Downloading Tailwind CSS v%s...\n", Version)
+	slog.Info("downloading Tailwind CSS", "version", Version)
 
 	// Create install directory
 	installDir, err := GetInstallDir()
@@ -208,7 +216,7 @@ func Download() error {
 	}
 	tmpFile.Close()
 
-	fmt.Printf("Downloaded %d bytes\n", written)
+	slog.Info("downloaded Tailwind CSS", "bytes", written)
 
 	// Make executable on Unix
 	if runtime.GOOS != "windows" {
@@ -229,7 +237,7 @@ func Download() error {
 		return fmt.Errorf("failed to write version file: %w", err)
 	}
 
-	fmt.Printf("Tailwind CSS v%s installed to %s\n", Version, binaryPath)
+	slog.Info("Tailwind CSS installed", "version", Version, "path", binaryPath)
 	return nil
 }
 
@@ -245,16 +253,16 @@ func EnsureInstalled() (string, error) {
 	if NeedsUpdate() {
 		installedVersion, _ := GetInstalledVersion()
 		if installedVersion != "" {
-			fmt.Printf("Tailwind CSS version mismatch (installed: %s, required: %s). Updating...\n", installedVersion, Version)
+			slog.Info("Tailwind CSS version mismatch, updating", "installed", installedVersion, "required", Version)
 		} else {
-			fmt.Println("Tailwind CSS not found. Installing...")
+			slog.Info("Tailwind CSS not found, installing")
 		}
 
 		if err := Download(); err != nil {
 			return "", err
 		}
 	} else {
-		fmt.Printf("Tailwind CSS v%s ready\n", Version)
+		slog.Info("Tailwind CSS ready", "version", Version)
 	}
 
 	return binaryPath, nil
@@ -287,38 +295,77 @@ func startWatchLocked() error {
 	inputPath := filepath.Join(projectPath, "static", "input.css")
 	outputPath := filepath.Join(projectPath, "static", "output.css")
 
-	fmt.Println("Starting Tailwind CSS watch process...")
-	watchCmd = exec.Command(tailwindPath, "-i", inputPath, "-o", outputPath, "--watch")
-	watchCmd.Stdout = os.Stdout
-	watchCmd.Stderr = os.Stderr
+	slog.Info("starting Tailwind CSS watch process")
+	cmd := exec.Command(tailwindPath, "-i", inputPath, "-o", outputPath, "--watch")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = process.ChildAttr()
 
-	if err := watchCmd.Start(); err != nil {
+	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("failed to start tailwind watch: %w", err)
 	}
 
-	// Monitor the process in background
+	done := make(chan struct{})
+	watchCmd = cmd
+	watchDone = done
+
+	// Monitor the process in background. done is closed before taking the
+	// lock so stopLocked can wait on it while holding watchMutex.
 	go func() {
-		err := watchCmd.Wait()
+		err := cmd.Wait()
+		close(done)
 		watchMutex.Lock()
 		defer watchMutex.Unlock()
+		if watchCmd != cmd {
+			// Stopped or replaced on purpose
+			return
+		}
 		if err != nil {
-			fmt.Printf("Tailwind CSS watch process exited: %v\n", err)
+			slog.Warn("Tailwind CSS watch process exited", "error", err)
 		}
 		watchCmd = nil
+		watchDone = nil
 	}()
 
 	return nil
 }
 
+// stopLocked asks the watch process to exit, killing it if it does not
+// within stopTimeout (must hold watchMutex)
+func stopLocked() {
+	if watchCmd == nil || watchCmd.Process == nil {
+		return
+	}
+	cmd, done := watchCmd, watchDone
+	watchCmd = nil
+	watchDone = nil
+
+	if err := process.Interrupt(cmd.Process); err != nil {
+		cmd.Process.Kill()
+	}
+	select {
+	case <-done:
+	case <-time.After(stopTimeout):
+		cmd.Process.Kill()
+		<-done
+	}
+}
+
+// IsRunning reports whether the watch process is alive
+func IsRunning() bool {
+	watchMutex.Lock()
+	defer watchMutex.Unlock()
+	return watchCmd != nil
+}
+
 // StopWatch stops the Tailwind CSS watch process
 func StopWatch() {
 	watchMutex.Lock()
 	defer watchMutex.Unlock()
 
 	if watchCmd != nil && watchCmd.Process != nil {
-		fmt.Println("Stopping Tailwind CSS watch process...")
-		watchCmd.Process.Kill()
-		watchCmd = nil
+		slog.Info("stopping Tailwind CSS watch process")
+		stopLocked()
 	}
 }
 
@@ -329,10 +376,8 @@ func RestartWatch() error {
 
 	// Stop existing process
 	if watchCmd != nil && watchCmd.Process != nil {
-		fmt.Println("Stopping Tailwind CSS watch process for restart...")
-		watchCmd.Process.Kill()
-		watchCmd.Wait() // Wait for it to actually stop
-		watchCmd = nil
+		slog.Info("stopping Tailwind CSS watch process for restart")
+		stopLocked()
 	}
 
 	// Start new process
@@ -349,7 +394,7 @@ func BuildOnce(projPath string) error {
 	inputPath := filepath.Join(projPath, "static", "input.css")
 	outputPath := filepath.Join(projPath, "static", "output.css")
 
-	fmt.Println("Building Tailwind CSS...")
+	slog.Info("building Tailwind CSS")
 	cmd := exec.Command(twPath, "-i", inputPath, "-o", outputPath)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
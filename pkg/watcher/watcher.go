@@ -1,63 +1,225 @@
 package watcher
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/phillip-england/thispage/pkg/compiler"
+	"github.com/phillip-england/thispage/pkg/livereload"
 )
 
-func Start(projectPath string) {
+// SourceDirs are the project directories watched recursively for changes
+var SourceDirs = []string{"templates", "components", "layouts", "static", "data"}
+
+// IgnorePatterns match editor temp files and other noise that never trigger a build
+var IgnorePatterns = []string{
+	"*.swp", "*.swo", "*.swx", "*~", "#*#", ".#*", "4913",
+	"*.tmp", "*.bak", ".DS_Store", "*___jb_tmp___", "*___jb_old___",
+}
+
+// debounceDelay groups a burst of saves into a single build
+const debounceDelay = 150 * time.Millisecond
+
+// pendingChanges accumulates what a burst of events requires
+type pendingChanges struct {
+	rebuild bool // a template, component, layout or data file changed
+	reload  bool // a static asset changed, browsers need a reload
+	css     bool // only the Tailwind output changed
+}
+
+// Watcher rebuilds the project when its sources change
+type Watcher struct {
+	fs   *fsnotify.Watcher
+	done chan struct{}
+}
+
+// Close stops watching and waits for any build in progress to finish
+func (w *Watcher) Close() error {
+	err := w.fs.Close()
+	<-w.done
+	return err
+}
+
+func Start(projectPath string) (*Watcher, error) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
-		fmt.Printf("failed to create watcher: %v\n", err)
-		return
+		return nil, fmt.Errorf("failed to create watcher: %w", err)
 	}
 
+	staticPath := filepath.Join(projectPath, "static")
+	done := make(chan struct{})
+
 	go func() {
-		defer watcher.Close()
+		defer close(done)
+
+		var pending pendingChanges
+		debounce := time.NewTimer(debounceDelay)
+		debounce.Stop()
+
 		for {
 			select {
 			case event, ok := <-watcher.Events:
 				if !ok {
 					return
 				}
-				if event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create || event.Op&fsnotify.Remove == fsnotify.Remove {
-					fmt.Println("Changes detected, rebuilding site...")
-					if err := compiler.Build(projectPath); err != nil {
-						fmt.Printf("Error rebuilding site: %v\n", err)
-					} else {
-						fmt.Println("Site rebuilt successfully!")
+				if event.Op == fsnotify.Chmod || isIgnored(event.Name) {
+					continue
+				}
+				// The project root is watched only to pick up new source dirs;
+				// live/, data.db and friends must never trigger a build
+				if !isSourcePath(projectPath, event.Name) {
+					continue
+				}
+
+				// Register directories created (or moved in) after startup
+				if event.Op&fsnotify.Create == fsnotify.Create {
+					if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+						addRecursive(watcher, event.Name)
 					}
 				}
+				// A moved or deleted directory takes its watch with it
+				if event.Op&(fsnotify.Rename|fsnotify.Remove) != 0 {
+					_ = watcher.Remove(event.Name)
+				}
+
+				switch {
+				case isWithin(staticPath, event.Name) && filepath.Base(event.Name) == "output.css":
+					// Tailwind rewrote the stylesheet, no rebuild needed
+					pending.css = true
+				case isWithin(staticPath, event.Name) && filepath.Base(event.Name) == "input.css":
+					// Tailwind picks this up and rewrites output.css
+					continue
+				case isWithin(staticPath, event.Name):
+					pending.reload = true
+				default:
+					pending.rebuild = true
+				}
+				debounce.Reset(debounceDelay)
+
+			case <-debounce.C:
+				flush(projectPath, pending)
+				pending = pendingChanges{}
+
 			case err, ok := <-watcher.Errors:
 				if !ok {
 					return
 				}
-				fmt.Println("error:", err)
+				slog.Error("watcher error", "error", err)
 			}
 		}
 	}()
 
-	for _, dir := range []string{"templates", "components"} {
+	for _, dir := range SourceDirs {
 		path := filepath.Join(projectPath, dir)
-		if err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-			if info.IsDir() {
-				err = watcher.Add(path)
-				if err != nil {
-					fmt.Printf("failed to add path to watcher: %v\n", err)
-				}
-			}
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+		addRecursive(watcher, path)
+	}
+	if err := watcher.Add(projectPath); err != nil {
+		slog.Warn("failed to add path to watcher", "path", projectPath, "error", err)
+	}
+
+	slog.Info("watching for changes", "project", projectPath)
+	return &Watcher{fs: watcher, done: done}, nil
+}
+
+// flush acts on the changes collected during one debounce window
+func flush(projectPath string, pending pendingChanges) {
+	if pending.rebuild {
+		slog.Info("changes detected, rebuilding site")
+		if err := compiler.Build(projectPath); err != nil {
+			slog.Error("rebuild failed", "error", err)
+			publishBuildError(err)
+			return
+		}
+		slog.Info("site rebuilt")
+		livereload.Publish(livereload.EventReload, "")
+		return
+	}
+	if pending.reload {
+		livereload.Publish(livereload.EventReload, "")
+		return
+	}
+	if pending.css {
+		livereload.Publish(livereload.EventCSS, "")
+	}
+}
+
+// addRecursive watches dir and every directory below it
+func addRecursive(watcher *fsnotify.Watcher, dir string) {
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
 			return nil
-		}); err != nil {
-			fmt.Printf("failed to walk directory %s: %v\n", path, err)
+		}
+		if path != dir && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(path); err != nil {
+			slog.Warn("failed to add path to watcher", "path", path, "error", err)
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Warn("failed to walk directory", "path", dir, "error", err)
+	}
+}
+
+// isIgnored reports whether path is an editor temp file or similar noise
+func isIgnored(path string) bool {
+	base := filepath.Base(path)
+	for _, pattern := range IgnorePatterns {
+		if matched, _ := filepath.Match(pattern, base); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// isSourcePath reports whether path lies in one of the SourceDirs
+func isSourcePath(projectPath, path string) bool {
+	rel, err := filepath.Rel(projectPath, path)
+	if err != nil {
+		return false
+	}
+	top := strings.SplitN(filepath.ToSlash(rel), "/", 2)[0]
+	for _, dir := range SourceDirs {
+		if top == dir {
+			return true
 		}
 	}
+	return false
+}
 
-	fmt.Printf("Watching for changes in %s\n", projectPath)
+// isWithin reports whether path is dir or below it
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// publishBuildError pushes a failed build to dev browsers as an error overlay
+func publishBuildError(err error) {
+	payload := compiler.BuildError{Message: err.Error()}
+	var buildErr *compiler.BuildError
+	if errors.As(err, &buildErr) {
+		payload = *buildErr
+	}
+	data, jsonErr := json.Marshal(payload)
+	if jsonErr != nil {
+		return
+	}
+	livereload.Publish(livereload.EventError, string(data))
 }